@@ -0,0 +1,291 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"scuffedsnap/database"
+	"scuffedsnap/handlers"
+	"scuffedsnap/models"
+)
+
+const cliUsage = `Usage: scuffedsnap <command> [arguments]
+
+Commands:
+  serve                                      Start the web server (default)
+  user create <username> <email> <password>  Create an email account (--admin to make it an admin)
+  user promote <username>                    Grant admin rights (--revoke to take them away)
+  user disable <username>                    Disable an account and revoke its sessions (--enable to undo)
+  user reset-password <username> <password>  Set a new password and revoke sessions
+  sessions purge                             Delete expired sessions (--user <username> for all of one user's)
+  messages purge-expired                     Delete expired disappearing messages
+`
+
+// cliCommands is every admin subcommand, keyed by "<group> <command>"
+var cliCommands = map[string]func([]string) error{
+	"user create":            cliCreateUser,
+	"user promote":           cliPromoteUser,
+	"user disable":           cliDisableUser,
+	"user reset-password":    cliResetPassword,
+	"sessions purge":         cliPurgeSessions,
+	"messages purge-expired": cliPurgeExpiredMessages,
+}
+
+// runCLI executes an admin subcommand against the same database as the
+// HTTP API. Every change is written to the audit log with no actor.
+func runCLI(args []string) error {
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		fmt.Print(cliUsage)
+		return nil
+	}
+
+	if len(args) < 2 {
+		fmt.Print(cliUsage)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+
+	name := args[0] + " " + args[1]
+	run, ok := cliCommands[name]
+	if !ok {
+		fmt.Print(cliUsage)
+		return fmt.Errorf("unknown command %q", name)
+	}
+
+	if err := database.Initialize(); err != nil {
+		return fmt.Errorf("database init failed: %w", err)
+	}
+	return run(args[2:])
+}
+
+func cliCreateUser(args []string) error {
+	fs := flag.NewFlagSet("user create", flag.ExitOnError)
+	admin := fs.Bool("admin", false, "grant admin rights")
+	fs.Parse(reorderFlags(fs, args))
+	if fs.NArg() != 3 {
+		return fmt.Errorf("usage: user create <username> <email> <password> [--admin]")
+	}
+
+	username := strings.TrimSpace(fs.Arg(0))
+	email := strings.TrimSpace(strings.ToLower(fs.Arg(1)))
+	password := fs.Arg(2)
+
+	if len(username) < 3 || len(username) > 20 {
+		return fmt.Errorf("username must be 3-20 characters")
+	}
+	if !strings.Contains(email, "@") {
+		return fmt.Errorf("invalid email address")
+	}
+	if len(password) < 6 {
+		return fmt.Errorf("password must be at least 6 characters")
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	user, err := database.CreateUser(username, email, string(hashedPassword))
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+	cliAudit("user.create", user.ID, "")
+
+	if *admin {
+		if err := database.SetUserAdmin(user.ID, true); err != nil {
+			return fmt.Errorf("user created but promotion failed: %w", err)
+		}
+		cliAudit("user.promote", user.ID, "")
+	}
+
+	fmt.Printf("Created user %s (id %d, admin %v)\n", user.Username, user.ID, *admin)
+	return nil
+}
+
+func cliPromoteUser(args []string) error {
+	fs := flag.NewFlagSet("user promote", flag.ExitOnError)
+	revoke := fs.Bool("revoke", false, "remove admin rights instead")
+	fs.Parse(reorderFlags(fs, args))
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: user promote <username> [--revoke]")
+	}
+
+	user, err := cliLookupUser(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if err := database.SetUserAdmin(user.ID, !*revoke); err != nil {
+		return err
+	}
+
+	action := "user.promote"
+	if *revoke {
+		action = "user.demote"
+	}
+	cliAudit(action, user.ID, "")
+
+	fmt.Printf("User %s admin: %v\n", user.Username, !*revoke)
+	return nil
+}
+
+func cliDisableUser(args []string) error {
+	fs := flag.NewFlagSet("user disable", flag.ExitOnError)
+	enable := fs.Bool("enable", false, "re-enable the account instead")
+	fs.Parse(reorderFlags(fs, args))
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: user disable <username> [--enable]")
+	}
+
+	user, err := cliLookupUser(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	// Same path as the admin API. Live WebSocket connections belong to the
+	// server process; revoking sessions makes them fail on reconnect.
+	if err := handlers.SetUserDisabled(nil, user.ID, !*enable, "via cli"); err != nil {
+		return err
+	}
+
+	fmt.Printf("User %s disabled: %v\n", user.Username, !*enable)
+	return nil
+}
+
+func cliResetPassword(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: user reset-password <username> <password>")
+	}
+
+	user, err := cliLookupUser(args[0])
+	if err != nil {
+		return err
+	}
+
+	if len(args[1]) < 6 {
+		return fmt.Errorf("password must be at least 6 characters")
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(args[1]), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	if err := database.ResetUserPassword(user.ID, string(hashedPassword)); err != nil {
+		return err
+	}
+	if err := database.DeleteAllUserSessions(user.ID); err != nil {
+		return fmt.Errorf("password reset but session revocation failed: %w", err)
+	}
+	cliAudit("user.reset_password", user.ID, "")
+
+	fmt.Printf("Password reset for %s, all sessions revoked\n", user.Username)
+	return nil
+}
+
+func cliPurgeSessions(args []string) error {
+	fs := flag.NewFlagSet("sessions purge", flag.ExitOnError)
+	username := fs.String("user", "", "delete every session of this user instead of only expired ones")
+	fs.Parse(reorderFlags(fs, args))
+	if fs.NArg() != 0 {
+		return fmt.Errorf("usage: sessions purge [--user <username>]")
+	}
+
+	if *username != "" {
+		user, err := cliLookupUser(*username)
+		if err != nil {
+			return err
+		}
+		if err := database.DeleteAllUserSessions(user.ID); err != nil {
+			return err
+		}
+		cliAudit("sessions.purge", user.ID, "")
+		fmt.Printf("Deleted all sessions for %s\n", user.Username)
+		return nil
+	}
+
+	count, err := database.DeleteExpiredSessions()
+	if err != nil {
+		return err
+	}
+	cliAudit("sessions.purge_expired", 0, fmt.Sprintf("%d sessions", count))
+
+	fmt.Printf("Deleted %d expired sessions\n", count)
+	return nil
+}
+
+func cliPurgeExpiredMessages(args []string) error {
+	expired, err := database.DeleteExpiredMessages()
+	if err != nil {
+		return err
+	}
+	cliAudit("messages.purge_expired", 0, fmt.Sprintf("%d messages", len(expired)))
+
+	fmt.Printf("Deleted %d expired messages\n", len(expired))
+	return nil
+}
+
+func cliLookupUser(username string) (*models.User, error) {
+	user, err := database.GetUserByUsername(username)
+	if err != nil {
+		return nil, fmt.Errorf("user %q not found", username)
+	}
+	return user, nil
+}
+
+// cliAudit records a CLI action; targetUserID 0 means no target user
+func cliAudit(action string, targetUserID int64, details string) {
+	if details == "" {
+		details = "via cli"
+	} else {
+		details += " via cli"
+	}
+
+	var target *int64
+	if targetUserID != 0 {
+		target = &targetUserID
+	}
+
+	if err := database.CreateAuditLog(nil, action, target, details); err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+}
+
+// reorderFlags moves flags ahead of positional arguments so they can be
+// given in any position, e.g. "user create bob bob@x.com secret --admin".
+// A flag that takes a value keeps the argument after it, and everything
+// after "--" is positional.
+func reorderFlags(fs *flag.FlagSet, args []string) []string {
+	var flags, positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			positional = append(positional, arg)
+			continue
+		}
+
+		flags = append(flags, arg)
+		name := strings.TrimLeft(arg, "-")
+		if strings.Contains(name, "=") {
+			continue
+		}
+		if f := fs.Lookup(name); f != nil && !isBoolFlag(f) && i+1 < len(args) {
+			i++
+			flags = append(flags, args[i])
+		}
+	}
+	return append(append(flags, "--"), positional...)
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
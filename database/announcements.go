@@ -0,0 +1,100 @@
+package database
+
+import (
+	"time"
+
+	"scuffedsnap/models"
+)
+
+const announcementsSchema = `
+	CREATE TABLE IF NOT EXISTS announcements (
+		id BIGSERIAL PRIMARY KEY,
+		author_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+		severity TEXT DEFAULT 'info',
+		text TEXT NOT NULL,
+		expires_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS announcement_deliveries (
+		announcement_id BIGINT NOT NULL REFERENCES announcements(id) ON DELETE CASCADE,
+		user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		delivered_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (announcement_id, user_id)
+	);
+`
+
+const announcementColumns = "a.id, a.author_id, a.severity, a.text, a.expires_at, a.created_at"
+
+// Announcement queries
+
+// CreateAnnouncement stores a new system announcement
+func CreateAnnouncement(authorID int64, severity models.AnnouncementSeverity, text string, expiresAt *time.Time) (*models.Announcement, error) {
+	a := &models.Announcement{}
+	err := DB.QueryRow(
+		`INSERT INTO announcements AS a (author_id, severity, text, expires_at) VALUES ($1, $2, $3, $4)
+		RETURNING `+announcementColumns,
+		authorID, string(severity), text, expiresAt,
+	).Scan(&a.ID, &a.AuthorID, &a.Severity, &a.Text, &a.ExpiresAt, &a.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// GetActiveAnnouncements retrieves announcements that have not expired, newest first
+func GetActiveAnnouncements() ([]models.Announcement, error) {
+	return queryAnnouncements(
+		`SELECT ` + announcementColumns + ` FROM announcements a
+		WHERE a.expires_at IS NULL OR a.expires_at > NOW()
+		ORDER BY a.created_at DESC`,
+	)
+}
+
+// ClaimUndeliveredAnnouncements records delivery of every active announcement
+// a user has not received yet and returns those, oldest first. Claiming and
+// fetching happen in one statement so concurrent connections of the same
+// user never both get an announcement.
+func ClaimUndeliveredAnnouncements(userID int64) ([]models.Announcement, error) {
+	return queryAnnouncements(
+		`WITH claimed AS (
+			INSERT INTO announcement_deliveries (announcement_id, user_id)
+			SELECT a.id, $1 FROM announcements a
+			WHERE a.expires_at IS NULL OR a.expires_at > NOW()
+			ON CONFLICT DO NOTHING
+			RETURNING announcement_id
+		)
+		SELECT `+announcementColumns+` FROM announcements a
+		JOIN claimed c ON c.announcement_id = a.id
+		ORDER BY a.created_at ASC`,
+		userID,
+	)
+}
+
+// MarkAnnouncementDelivered records that a user has received an announcement
+func MarkAnnouncementDelivered(announcementID, userID int64) error {
+	_, err := DB.Exec(
+		`INSERT INTO announcement_deliveries (announcement_id, user_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`,
+		announcementID, userID,
+	)
+	return err
+}
+
+func queryAnnouncements(query string, args ...interface{}) ([]models.Announcement, error) {
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var announcements []models.Announcement
+	for rows.Next() {
+		var a models.Announcement
+		if err := rows.Scan(&a.ID, &a.AuthorID, &a.Severity, &a.Text, &a.ExpiresAt, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		announcements = append(announcements, a)
+	}
+	return announcements, nil
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"scuffedsnap/models"
+)
+
+const auditSchema = `
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id BIGSERIAL PRIMARY KEY,
+		actor_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+		action TEXT NOT NULL,
+		target_user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+		details TEXT DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log(created_at);
+`
+
+const insertAuditLog = "INSERT INTO audit_log (actor_id, action, target_user_id, details) VALUES ($1, $2, $3, $4)"
+
+// Audit log queries
+
+// CreateAuditLog records an administrative action. actorID and targetUserID
+// may be nil when there is no acting user or no affected user.
+func CreateAuditLog(actorID *int64, action string, targetUserID *int64, details string) error {
+	_, err := DB.Exec(insertAuditLog, actorID, action, targetUserID, details)
+	return err
+}
+
+// GetAuditLog retrieves the most recent audit log entries
+func GetAuditLog(limit, offset int) ([]models.AuditLogEntry, error) {
+	rows, err := DB.Query(
+		`SELECT id, actor_id, action, target_user_id, COALESCE(details, ''), created_at
+		FROM audit_log
+		ORDER BY created_at DESC
+		LIMIT $1 OFFSET $2`,
+		limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.AuditLogEntry
+	for rows.Next() {
+		var entry models.AuditLogEntry
+		if err := rows.Scan(&entry.ID, &entry.ActorID, &entry.Action, &entry.TargetUserID, &entry.Details, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
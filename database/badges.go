@@ -0,0 +1,33 @@
+package database
+
+import (
+	"scuffedsnap/models"
+)
+
+// Badge queries
+
+// GetBadgeCounts counts a user's unread messages, conversations with unread
+// messages, pending friend requests and unread mentions
+func GetBadgeCounts(userID int64) (*models.BadgeCounts, error) {
+	var b models.BadgeCounts
+	err := DB.QueryRow(
+		`WITH unread AS (
+			SELECT m.id, m.sender_id FROM messages m
+			WHERE m.receiver_id = $1 AND m.sender_id != $1
+			  AND m.read_at IS NULL AND m.deleted_at IS NULL
+			  AND (m.expires_at IS NULL OR m.expires_at > NOW())
+			  AND NOT EXISTS (SELECT 1 FROM message_hidden h WHERE h.message_id = m.id AND h.user_id = $1)
+		)
+		SELECT
+			(SELECT COUNT(*) FROM unread),
+			(SELECT COUNT(DISTINCT sender_id) FROM unread),
+			(SELECT COUNT(*) FROM friends f WHERE f.friend_id = $1 AND f.status = 'pending'),
+			(SELECT COUNT(*) FROM message_mentions mn JOIN unread ON unread.id = mn.message_id WHERE mn.user_id = $1)`,
+		userID,
+	).Scan(&b.UnreadMessages, &b.UnreadConversations, &b.FriendRequests, &b.UnreadMentions)
+	if err != nil {
+		return nil, err
+	}
+	b.Total = b.UnreadMessages + b.FriendRequests
+	return &b, nil
+}
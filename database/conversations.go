@@ -0,0 +1,143 @@
+package database
+
+import (
+	"database/sql"
+
+	"scuffedsnap/models"
+)
+
+const conversationsSchema = `
+	CREATE TABLE IF NOT EXISTS conversation_settings (
+		user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		other_user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		muted BOOLEAN NOT NULL DEFAULT FALSE,
+		muted_until TIMESTAMP,
+		archived BOOLEAN NOT NULL DEFAULT FALSE,
+		keep_archived BOOLEAN NOT NULL DEFAULT FALSE,
+		pinned_at TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, other_user_id)
+	);
+`
+
+// conversationSettingsColumns selects ConversationSettings from the cs
+// alias, which may be a missing LEFT JOIN row. Mutes past their end time
+// read as unmuted.
+const conversationSettingsColumns = `
+	COALESCE(cs.muted AND (cs.muted_until IS NULL OR cs.muted_until > NOW()), FALSE),
+	CASE WHEN cs.muted AND cs.muted_until > NOW() THEN cs.muted_until END,
+	COALESCE(cs.archived, FALSE), COALESCE(cs.keep_archived, FALSE), cs.pinned_at`
+
+func conversationSettingsDest(s *models.ConversationSettings) []interface{} {
+	return []interface{}{&s.Muted, &s.MutedUntil, &s.Archived, &s.KeepArchived, &s.PinnedAt}
+}
+
+// Conversation settings queries
+
+// GetConversationSettings retrieves a user's settings for their conversation
+// with otherUserID, or the defaults if they never changed any
+func GetConversationSettings(userID, otherUserID int64) (*models.ConversationSettings, error) {
+	var s models.ConversationSettings
+	err := DB.QueryRow(
+		`SELECT `+conversationSettingsColumns+`
+		FROM (SELECT 1) AS one
+		LEFT JOIN conversation_settings cs ON cs.user_id = $1 AND cs.other_user_id = $2`,
+		userID, otherUserID,
+	).Scan(conversationSettingsDest(&s)...)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// SaveConversationSettings stores a user's settings for their conversation
+// with otherUserID. Pinning a conversation that is not pinned yet fails
+// with sql.ErrNoRows when the user already has pinLimit pinned. A user's
+// pins are serialized, so concurrent requests cannot overshoot the limit.
+func SaveConversationSettings(userID, otherUserID int64, s *models.ConversationSettings, pinLimit int) (*models.ConversationSettings, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if s.PinnedAt != nil {
+		if _, err := tx.Exec(
+			"SELECT pg_advisory_xact_lock(hashtextextended('conversation_pins:' || $1::BIGINT, 0))", userID,
+		); err != nil {
+			return nil, err
+		}
+
+		var others int
+		var pinned bool
+		if err := tx.QueryRow(
+			`SELECT COUNT(*) FILTER (WHERE other_user_id <> $2), COALESCE(BOOL_OR(other_user_id = $2), FALSE)
+			FROM conversation_settings WHERE user_id = $1 AND pinned_at IS NOT NULL`,
+			userID, otherUserID,
+		).Scan(&others, &pinned); err != nil {
+			return nil, err
+		}
+		if !pinned && others >= pinLimit {
+			return nil, sql.ErrNoRows
+		}
+	}
+
+	var saved models.ConversationSettings
+	err = tx.QueryRow(
+		`WITH cs AS (
+			INSERT INTO conversation_settings (user_id, other_user_id, muted, muted_until, archived, keep_archived, pinned_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (user_id, other_user_id) DO UPDATE SET
+				muted = EXCLUDED.muted, muted_until = EXCLUDED.muted_until, archived = EXCLUDED.archived,
+				keep_archived = EXCLUDED.keep_archived, pinned_at = EXCLUDED.pinned_at, updated_at = NOW()
+			RETURNING *
+		)
+		SELECT `+conversationSettingsColumns+` FROM cs`,
+		userID, otherUserID, s.Muted, s.MutedUntil, s.Archived, s.KeepArchived, s.PinnedAt,
+	).Scan(conversationSettingsDest(&saved)...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// IsConversationMuted reports whether userID currently has their
+// conversation with otherUserID muted
+func IsConversationMuted(userID, otherUserID int64) (bool, error) {
+	s, err := GetConversationSettings(userID, otherUserID)
+	if err != nil {
+		return false, err
+	}
+	return s.Muted, nil
+}
+
+// UnarchiveConversation brings a conversation back out of the archive for
+// both participants, except where they chose to keep it archived. It
+// returns the users whose archive changed.
+func UnarchiveConversation(userID, otherUserID int64) ([]int64, error) {
+	rows, err := DB.Query(
+		`UPDATE conversation_settings SET archived = FALSE, updated_at = NOW()
+		WHERE ((user_id = $1 AND other_user_id = $2) OR (user_id = $2 AND other_user_id = $1))
+		  AND archived AND NOT keep_archived
+		RETURNING user_id`,
+		userID, otherUserID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, id)
+	}
+	return userIDs, rows.Err()
+}
@@ -2,11 +2,12 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"log"
 	"os"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"scuffedsnap/models"
 )
 
@@ -54,6 +55,7 @@ func createTables() error {
 		avatar TEXT DEFAULT '',
 		auth_method TEXT DEFAULT 'email',
 		is_disabled BOOLEAN DEFAULT FALSE,
+		is_admin BOOLEAN DEFAULT FALSE,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);
 
@@ -94,14 +96,40 @@ func createTables() error {
 	CREATE INDEX IF NOT EXISTS idx_friends_user ON friends(user_id);
 	CREATE INDEX IF NOT EXISTS idx_friends_friend ON friends(friend_id);
 	CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);
+
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin BOOLEAN DEFAULT FALSE;
 	`
 
-	_, err := DB.Exec(tables)
-	return err
+	if _, err := DB.Exec(tables); err != nil {
+		return err
+	}
+
+	// Feature tables live next to their queries
+	for _, schema := range []string{auditSchema, reportsSchema, announcementsSchema, revisionsSchema, deletionSchema, repliesSchema, mentionsSchema, reactionsSchema, receiptsSchema, snapsSchema, scheduledSchema, pinsSchema, linkPreviewsSchema, forwardingSchema, formattingSchema, idempotencySchema, draftsSchema, pollsSchema, starsSchema, conversationsSchema,
+		disappearingSchema, pushSchema} {
+		if _, err := DB.Exec(schema); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // User queries
 
+// userColumns selects every user field in the order scanUser expects
+const userColumns = `id, username, email, password, avatar, created_at, COALESCE(auth_method, 'email'),
+	COALESCE(is_disabled, FALSE), COALESCE(is_admin, FALSE), COALESCE(send_read_receipts, TRUE)`
+
+func scanUser(row rowScanner) (*models.User, error) {
+	user := &models.User{}
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Avatar, &user.CreatedAt,
+		&user.AuthMethod, &user.IsDisabled, &user.IsAdmin, &user.SendReadReceipts)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
 // CreateUser inserts a new user into the database
 func CreateUser(username, email, password string) (*models.User, error) {
 	return CreateUserWithAuth(username, email, password, "email")
@@ -109,15 +137,11 @@ func CreateUser(username, email, password string) (*models.User, error) {
 
 // CreateUserWithAuth inserts a new user with auth method tracking
 func CreateUserWithAuth(username, email, password, authMethod string) (*models.User, error) {
-	result, err := DB.Exec(
-		"INSERT INTO users (username, email, password, auth_method) VALUES (?, ?, ?, ?)",
+	var id int64
+	err := DB.QueryRow(
+		"INSERT INTO users (username, email, password, auth_method) VALUES ($1, $2, $3, $4) RETURNING id",
 		username, email, password, authMethod,
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	id, err := result.LastInsertId()
+	).Scan(&id)
 	if err != nil {
 		return nil, err
 	}
@@ -127,48 +151,24 @@ func CreateUserWithAuth(username, email, password, authMethod string) (*models.U
 
 // GetUserByID retrieves a user by their ID
 func GetUserByID(id int64) (*models.User, error) {
-	user := &models.User{}
-	err := DB.QueryRow(
-		"SELECT id, username, email, password, avatar, created_at, COALESCE(auth_method, 'email'), COALESCE(is_disabled, 0) FROM users WHERE id = ?",
-		id,
-	).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Avatar, &user.CreatedAt, &user.AuthMethod, &user.IsDisabled)
-	if err != nil {
-		return nil, err
-	}
-	return user, nil
+	return scanUser(DB.QueryRow("SELECT "+userColumns+" FROM users WHERE id = $1", id))
 }
 
 // GetUserByUsername retrieves a user by their username
 func GetUserByUsername(username string) (*models.User, error) {
-	user := &models.User{}
-	err := DB.QueryRow(
-		"SELECT id, username, email, password, avatar, created_at, COALESCE(auth_method, 'email'), COALESCE(is_disabled, 0) FROM users WHERE username = ?",
-		username,
-	).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Avatar, &user.CreatedAt, &user.AuthMethod, &user.IsDisabled)
-	if err != nil {
-		return nil, err
-	}
-	return user, nil
+	return scanUser(DB.QueryRow("SELECT "+userColumns+" FROM users WHERE username = $1", username))
 }
 
 // GetUserByEmail retrieves a user by their email
 func GetUserByEmail(email string) (*models.User, error) {
-	user := &models.User{}
-	err := DB.QueryRow(
-		"SELECT id, username, email, password, avatar, created_at, COALESCE(auth_method, 'email'), COALESCE(is_disabled, 0) FROM users WHERE email = ?",
-		email,
-	).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Avatar, &user.CreatedAt, &user.AuthMethod, &user.IsDisabled)
-	if err != nil {
-		return nil, err
-	}
-	return user, nil
+	return scanUser(DB.QueryRow("SELECT "+userColumns+" FROM users WHERE email = $1", email))
 }
 
 // SearchUsers searches for users by username
 func SearchUsers(query string, currentUserID int64) ([]models.UserResponse, error) {
 	rows, err := DB.Query(
 		`SELECT id, username, email, avatar, created_at FROM users 
-		WHERE username LIKE ? AND id != ? LIMIT 20`,
+		WHERE username LIKE $1 AND id != $2 LIMIT 20`,
 		"%"+query+"%", currentUserID,
 	)
 	if err != nil {
@@ -192,7 +192,7 @@ func SearchUsers(query string, currentUserID int64) ([]models.UserResponse, erro
 // CreateSession creates a new session for a user
 func CreateSession(sessionID string, userID int64, expiresAt time.Time) error {
 	_, err := DB.Exec(
-		"INSERT INTO sessions (id, user_id, expires_at) VALUES (?, ?, ?)",
+		"INSERT INTO sessions (id, user_id, expires_at) VALUES ($1, $2, $3)",
 		sessionID, userID, expiresAt,
 	)
 	return err
@@ -202,7 +202,7 @@ func CreateSession(sessionID string, userID int64, expiresAt time.Time) error {
 func GetSession(sessionID string) (*models.Session, error) {
 	session := &models.Session{}
 	err := DB.QueryRow(
-		"SELECT id, user_id, created_at, expires_at FROM sessions WHERE id = ? AND expires_at > datetime('now')",
+		"SELECT id, user_id, created_at, expires_at FROM sessions WHERE id = $1 AND expires_at > NOW()",
 		sessionID,
 	).Scan(&session.ID, &session.UserID, &session.CreatedAt, &session.ExpiresAt)
 	if err != nil {
@@ -213,43 +213,183 @@ func GetSession(sessionID string) (*models.Session, error) {
 
 // DeleteSession removes a session
 func DeleteSession(sessionID string) error {
-	_, err := DB.Exec("DELETE FROM sessions WHERE id = ?", sessionID)
+	_, err := DB.Exec("DELETE FROM sessions WHERE id = $1", sessionID)
 	return err
 }
 
 // DeleteUserSessions removes all sessions for a user
 func DeleteUserSessions(userID int64) error {
-	_, err := DB.Exec("DELETE FROM sessions WHERE user_id = ?", userID)
+	_, err := DB.Exec("DELETE FROM sessions WHERE user_id = $1", userID)
 	return err
 }
 
+// DeleteExpiredSessions removes sessions past their expiry and returns how
+// many were deleted
+func DeleteExpiredSessions() (int64, error) {
+	result, err := DB.Exec("DELETE FROM sessions WHERE expires_at < NOW()")
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 // Message queries
 
-// CreateMessage creates a new message
-func CreateMessage(senderID, receiverID int64, content, msgType string, expiresAt *time.Time) (*models.Message, error) {
-	result, err := DB.Exec(
-		"INSERT INTO messages (sender_id, receiver_id, content, type, expires_at) VALUES (?, ?, ?, ?, ?)",
-		senderID, receiverID, content, msgType, expiresAt,
-	)
+// messageColumns selects every message field from a table aliased "m", in
+// the order scanMessage expects
+const messageColumns = `m.id, m.sender_id, m.receiver_id, m.content, m.type, m.expires_at, m.read_at,
+	m.created_at, COALESCE(m.edited, FALSE), m.updated_at, m.deleted_at, m.replied_to_message_id,
+	(SELECT COUNT(*) FROM messages r WHERE r.replied_to_message_id = m.id AND r.deleted_at IS NULL),
+	ARRAY(SELECT mm.user_id FROM message_mentions mm WHERE mm.message_id = m.id ORDER BY mm.user_id),
+	m.delivered_at, COALESCE(m.max_views, 1), COALESCE(m.view_count, 0), m.opened_at, m.purged_at,
+	EXISTS(SELECT 1 FROM message_pins mp WHERE mp.message_id = m.id), m.link_preview,
+	m.forwarded_from_message_id, m.forwarded_from_sender_id, m.forwarded_from_receiver_id,
+	COALESCE(m.format, 'plain'), COALESCE(m.content_html, ''), COALESCE(m.client_msg_id, ''),
+	m.expire_after_read`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanMessage scans messageColumns into msg followed by any extra columns
+func scanMessage(row rowScanner, msg *models.Message, extra ...interface{}) error {
+	dest := []interface{}{
+		&msg.ID, &msg.SenderID, &msg.ReceiverID, &msg.Content, &msg.Type, &msg.ExpiresAt, &msg.ReadAt,
+		&msg.CreatedAt, &msg.Edited, &msg.UpdatedAt, &msg.DeletedAt, &msg.RepliedToMessageID,
+		&msg.ReplyCount, pq.Array(&msg.Mentions), &msg.DeliveredAt,
+	}
+
+	var snap models.SnapInfo
+	var purgedAt *time.Time
+	var linkPreview []byte
+	var forward models.ForwardInfo
+	var forwardSenderID, forwardReceiverID sql.NullInt64
+	dest = append(dest, &snap.MaxViews, &snap.ViewCount, &snap.OpenedAt, &purgedAt, &msg.Pinned, &linkPreview,
+		&forward.MessageID, &forwardSenderID, &forwardReceiverID, &msg.Format, &msg.ContentHTML, &msg.ClientMsgID,
+		&msg.ExpireAfterRead)
+
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+	msg.UpdateStatus()
+
+	if linkPreview != nil {
+		msg.LinkPreview = &models.LinkPreview{}
+		if err := json.Unmarshal(linkPreview, msg.LinkPreview); err != nil {
+			msg.LinkPreview = nil
+		}
+	}
+
+	if forwardSenderID.Valid {
+		forward.SenderID = forwardSenderID.Int64
+		forward.ReceiverID = forwardReceiverID.Int64
+		msg.ForwardedFrom = &forward
+	}
+
+	if msg.Type == models.MessageTypeSnap {
+		snap.UpdateStatus(purgedAt)
+		msg.Snap = &snap
+	}
+	return nil
+}
+
+// NewMessage holds the fields of a message to be created
+type NewMessage struct {
+	SenderID           int64
+	ReceiverID         int64
+	Content            string
+	Type               string
+	Format             string // Defaults to plain
+	ContentHTML        string // Rendered markdown, if Format is markdown
+	ExpiresAt          *time.Time
+	RepliedToMessageID *int64
+	MaxViews           int                 // Snaps only: how many times the receiver may open it
+	ForwardedFrom      *models.ForwardInfo // Set when the message is a forward
+	ClientMsgID        string              // Client-generated ID used to deduplicate retries
+	Poll               *NewPoll            // Polls only
+}
+
+// CreateMessage creates a new message, applying the conversation's
+// disappearing timer. It returns sql.ErrNoRows if the sender already has a
+// message with the same ClientMsgID.
+func CreateMessage(m NewMessage) (*models.Message, error) {
+	if m.MaxViews < 1 {
+		m.MaxViews = 1
+	}
+
+	var forwardMessageID, forwardSenderID, forwardReceiverID *int64
+	if f := m.ForwardedFrom; f != nil {
+		forwardMessageID, forwardSenderID, forwardReceiverID = f.MessageID, &f.SenderID, &f.ReceiverID
+	}
+
+	if m.Format == "" {
+		m.Format = models.MessageFormatPlain
+	}
+
+	var clientMsgID *string
+	if m.ClientMsgID != "" {
+		clientMsgID = &m.ClientMsgID
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// The earlier of the message's own expiry and the timer's wins
+	timer, err := scanDisappearingTimer(tx.QueryRow(disappearingTimerQuery, m.SenderID, m.ReceiverID))
 	if err != nil {
 		return nil, err
 	}
+	var expireAfterRead *int
+	if timer.AfterRead {
+		expireAfterRead = &timer.Seconds
+	} else if timer.Seconds > 0 {
+		t := time.Now().Add(time.Duration(timer.Seconds) * time.Second)
+		if m.ExpiresAt == nil || t.Before(*m.ExpiresAt) {
+			m.ExpiresAt = &t
+		}
+	}
 
-	id, err := result.LastInsertId()
+	var mediaPath *string
+	if m.Type == models.MessageTypeSnap {
+		mediaPath = &m.Content
+	}
+
+	var id int64
+	err = tx.QueryRow(
+		`INSERT INTO messages (sender_id, receiver_id, content, type, format, content_html, expires_at,
+			replied_to_message_id, max_views, forwarded_from_message_id, forwarded_from_sender_id, forwarded_from_receiver_id,
+			client_msg_id, expire_after_read, media_path)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		ON CONFLICT (sender_id, client_msg_id) WHERE client_msg_id IS NOT NULL DO NOTHING
+		RETURNING id`,
+		m.SenderID, m.ReceiverID, m.Content, m.Type, m.Format, m.ContentHTML, m.ExpiresAt,
+		m.RepliedToMessageID, m.MaxViews, forwardMessageID, forwardSenderID, forwardReceiverID,
+		clientMsgID, expireAfterRead, mediaPath,
+	).Scan(&id)
 	if err != nil {
 		return nil, err
 	}
 
+	if m.Poll != nil {
+		if err := createPoll(tx, id, m.Poll); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
 	return GetMessageByID(id)
 }
 
 // GetMessageByID retrieves a message by its ID
 func GetMessageByID(id int64) (*models.Message, error) {
 	msg := &models.Message{}
-	err := DB.QueryRow(
-		"SELECT id, sender_id, receiver_id, content, type, expires_at, read_at, created_at FROM messages WHERE id = ?",
-		id,
-	).Scan(&msg.ID, &msg.SenderID, &msg.ReceiverID, &msg.Content, &msg.Type, &msg.ExpiresAt, &msg.ReadAt, &msg.CreatedAt)
+	err := scanMessage(DB.QueryRow("SELECT "+messageColumns+" FROM messages m WHERE m.id = $1", id), msg)
 	if err != nil {
 		return nil, err
 	}
@@ -259,15 +399,16 @@ func GetMessageByID(id int64) (*models.Message, error) {
 // GetMessagesBetweenUsers retrieves messages between two users
 func GetMessagesBetweenUsers(userID1, userID2 int64, limit, offset int) ([]models.MessageWithSender, error) {
 	rows, err := DB.Query(
-		`SELECT m.id, m.sender_id, m.receiver_id, m.content, m.type, m.expires_at, m.read_at, m.created_at,
-		        u.username, u.avatar
+		`SELECT `+messageColumns+`, u.username, u.avatar, `+replyPreviewColumns+`
 		FROM messages m
 		JOIN users u ON m.sender_id = u.id
-		WHERE ((m.sender_id = ? AND m.receiver_id = ?) OR (m.sender_id = ? AND m.receiver_id = ?))
-		  AND (m.expires_at IS NULL OR m.expires_at > datetime('now'))
+		`+replyPreviewJoin+`
+		WHERE ((m.sender_id = $1 AND m.receiver_id = $2) OR (m.sender_id = $2 AND m.receiver_id = $1))
+		  AND (m.expires_at IS NULL OR m.expires_at > NOW())
+		  AND NOT EXISTS (SELECT 1 FROM message_hidden h WHERE h.message_id = m.id AND h.user_id = $1)
 		ORDER BY m.created_at DESC
-		LIMIT ? OFFSET ?`,
-		userID1, userID2, userID2, userID1, limit, offset,
+		LIMIT $3 OFFSET $4`,
+		userID1, userID2, limit, offset,
 	)
 	if err != nil {
 		return nil, err
@@ -276,15 +417,11 @@ func GetMessagesBetweenUsers(userID1, userID2 int64, limit, offset int) ([]model
 
 	var messages []models.MessageWithSender
 	for rows.Next() {
-		var msg models.MessageWithSender
-		if err := rows.Scan(
-			&msg.ID, &msg.SenderID, &msg.ReceiverID, &msg.Content, &msg.Type,
-			&msg.ExpiresAt, &msg.ReadAt, &msg.CreatedAt,
-			&msg.SenderUsername, &msg.SenderAvatar,
-		); err != nil {
+		msg, err := scanMessageWithSender(rows)
+		if err != nil {
 			return nil, err
 		}
-		messages = append(messages, msg)
+		messages = append(messages, *msg)
 	}
 
 	// Reverse to get chronological order
@@ -292,18 +429,29 @@ func GetMessagesBetweenUsers(userID1, userID2 int64, limit, offset int) ([]model
 		messages[i], messages[j] = messages[j], messages[i]
 	}
 
+	if err := prepareMessages(messages, userID1); err != nil {
+		return nil, err
+	}
+
 	return messages, nil
 }
 
-// GetConversations retrieves all conversations for a user
-func GetConversations(userID int64) ([]models.Conversation, error) {
+// GetConversations retrieves a user's archived or unarchived conversations,
+// pinned ones first
+func GetConversations(userID int64, archived bool) ([]models.Conversation, error) {
 	rows, err := DB.Query(
-		`SELECT DISTINCT 
-			CASE WHEN m.sender_id = ? THEN m.receiver_id ELSE m.sender_id END as other_user_id
-		FROM messages m
-		WHERE m.sender_id = ? OR m.receiver_id = ?
-		ORDER BY m.created_at DESC`,
-		userID, userID, userID,
+		`SELECT c.other_user_id, `+conversationSettingsColumns+`
+		FROM (
+			SELECT CASE WHEN m.sender_id = $1 THEN m.receiver_id ELSE m.sender_id END as other_user_id,
+				MAX(m.created_at) AS last_at
+			FROM messages m
+			WHERE m.sender_id = $1 OR m.receiver_id = $1
+			GROUP BY other_user_id
+		) c
+		LEFT JOIN conversation_settings cs ON cs.user_id = $1 AND cs.other_user_id = c.other_user_id
+		WHERE COALESCE(cs.archived, FALSE) = $2
+		ORDER BY cs.pinned_at DESC NULLS LAST, c.last_at DESC`,
+		userID, archived,
 	)
 	if err != nil {
 		return nil, err
@@ -315,7 +463,8 @@ func GetConversations(userID int64) ([]models.Conversation, error) {
 
 	for rows.Next() {
 		var otherUserID int64
-		if err := rows.Scan(&otherUserID); err != nil {
+		var settings models.ConversationSettings
+		if err := rows.Scan(append([]interface{}{&otherUserID}, conversationSettingsDest(&settings)...)...); err != nil {
 			return nil, err
 		}
 
@@ -331,31 +480,42 @@ func GetConversations(userID int64) ([]models.Conversation, error) {
 
 		// Get last message
 		var lastMsg models.Message
-		err = DB.QueryRow(
-			`SELECT id, sender_id, receiver_id, content, type, expires_at, read_at, created_at
-			FROM messages
-			WHERE ((sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?))
-			  AND (expires_at IS NULL OR expires_at > datetime('now'))
-			ORDER BY created_at DESC LIMIT 1`,
-			userID, otherUserID, otherUserID, userID,
-		).Scan(&lastMsg.ID, &lastMsg.SenderID, &lastMsg.ReceiverID, &lastMsg.Content,
-			&lastMsg.Type, &lastMsg.ExpiresAt, &lastMsg.ReadAt, &lastMsg.CreatedAt)
+		err = scanMessage(DB.QueryRow(
+			`SELECT `+messageColumns+`
+			FROM messages m
+			WHERE ((m.sender_id = $1 AND m.receiver_id = $2) OR (m.sender_id = $2 AND m.receiver_id = $1))
+			  AND (m.expires_at IS NULL OR m.expires_at > NOW())
+			  AND NOT EXISTS (SELECT 1 FROM message_hidden h WHERE h.message_id = m.id AND h.user_id = $1)
+			ORDER BY m.created_at DESC LIMIT 1`,
+			userID, otherUserID,
+		), &lastMsg)
 
 		// Count unread messages
 		var unreadCount int
 		DB.QueryRow(
-			`SELECT COUNT(*) FROM messages
-			WHERE sender_id = ? AND receiver_id = ? AND read_at IS NULL`,
+			`SELECT COUNT(*) FROM messages m
+			WHERE m.sender_id = $1 AND m.receiver_id = $2 AND m.read_at IS NULL AND m.deleted_at IS NULL
+			  AND (m.expires_at IS NULL OR m.expires_at > NOW())
+			  AND NOT EXISTS (SELECT 1 FROM message_hidden h WHERE h.message_id = m.id AND h.user_id = $2)`,
 			otherUserID, userID,
 		).Scan(&unreadCount)
 
 		conv := models.Conversation{
-			User:        user.ToResponse(),
-			UnreadCount: unreadCount,
+			User:                 user.ToResponse(),
+			UnreadCount:          unreadCount,
+			ConversationSettings: settings,
 		}
 		if err == nil {
+			lastMsg.RedactReadReceipt(userID, user.SendReadReceipts)
+			lastMsg.HideSnapContent()
 			conv.LastMessage = &lastMsg
 		}
+		if user.SendReadReceipts {
+			conv.ReadWatermark, _ = GetReadWatermark(otherUserID, userID)
+		}
+		if timer, err := GetDisappearingTimer(userID, otherUserID); err == nil {
+			conv.DisappearingTimer = timer.Timer
+		}
 
 		conversations = append(conversations, conv)
 	}
@@ -363,19 +523,105 @@ func GetConversations(userID int64) ([]models.Conversation, error) {
 	return conversations, nil
 }
 
-// MarkMessagesAsRead marks all messages from a sender to receiver as read
-func MarkMessagesAsRead(senderID, receiverID int64) error {
-	_, err := DB.Exec(
-		"UPDATE messages SET read_at = datetime('now') WHERE sender_id = ? AND receiver_id = ? AND read_at IS NULL",
-		senderID, receiverID,
+// MarkMessagesAsRead marks unread messages from a sender to receiver as read,
+// up to and including upToID (0 for all of them), starting the clock on
+// messages that expire after being read. It returns the IDs that changed and
+// advances the receiver's read watermark.
+func MarkMessagesAsRead(senderID, receiverID, upToID int64) ([]int64, error) {
+	rows, err := DB.Query(
+		`UPDATE messages SET read_at = NOW(), delivered_at = COALESCE(delivered_at, NOW()),
+			expires_at = LEAST(expires_at, NOW() + expire_after_read * INTERVAL '1 second')
+		WHERE sender_id = $1 AND receiver_id = $2 AND read_at IS NULL AND ($3 = 0 OR id <= $3)
+		RETURNING id`,
+		senderID, receiverID, upToID,
 	)
-	return err
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	var maxID int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+		if id > maxID {
+			maxID = id
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if maxID > 0 {
+		if err := updateReadWatermark(receiverID, senderID, maxID); err != nil {
+			return ids, err
+		}
+	}
+	return ids, nil
 }
 
-// DeleteExpiredMessages removes messages that have expired
-func DeleteExpiredMessages() error {
-	_, err := DB.Exec("DELETE FROM messages WHERE expires_at IS NOT NULL AND expires_at < datetime('now')")
-	return err
+// ExpiredMessage is a disappearing message DeleteExpiredMessages removed
+type ExpiredMessage struct {
+	ID         int64
+	SenderID   int64
+	ReceiverID int64
+	Unread     bool // The receiver never read it
+}
+
+// expiredMessagesWhere matches messages past their expiry. Snaps are left
+// until the snap janitor has purged their media.
+const expiredMessagesWhere = `expires_at IS NOT NULL AND expires_at < NOW()
+	AND (type <> 'snap' OR purged_at IS NOT NULL)`
+
+// DeleteExpiredMessages removes messages that have expired, for both
+// participants, along with their stars, pins and revisions, and returns
+// what it deleted
+func DeleteExpiredMessages() ([]ExpiredMessage, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// NOW() is fixed for the transaction, so every statement sees the same
+	// set of expired messages
+	for _, table := range []string{"message_stars", "message_pins", "message_revisions"} {
+		if _, err := tx.Exec(
+			"DELETE FROM " + table + " WHERE message_id IN (SELECT id FROM messages WHERE " + expiredMessagesWhere + ")",
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := tx.Query(
+		"DELETE FROM messages WHERE " + expiredMessagesWhere + " RETURNING id, sender_id, receiver_id, read_at IS NULL",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var expired []ExpiredMessage
+	for rows.Next() {
+		var e ExpiredMessage
+		if err := rows.Scan(&e.ID, &e.SenderID, &e.ReceiverID, &e.Unread); err != nil {
+			return nil, err
+		}
+		expired = append(expired, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return expired, nil
 }
 
 // Friend queries
@@ -383,7 +629,7 @@ func DeleteExpiredMessages() error {
 // CreateFriendRequest creates a friend request
 func CreateFriendRequest(userID, friendID int64) error {
 	_, err := DB.Exec(
-		"INSERT INTO friends (user_id, friend_id, status) VALUES (?, ?, 'pending')",
+		"INSERT INTO friends (user_id, friend_id, status) VALUES ($1, $2, 'pending')",
 		userID, friendID,
 	)
 	return err
@@ -394,7 +640,7 @@ func GetFriendship(userID, friendID int64) (*models.Friend, error) {
 	friend := &models.Friend{}
 	err := DB.QueryRow(
 		`SELECT id, user_id, friend_id, status, created_at FROM friends 
-		WHERE (user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)`,
+		WHERE (user_id = $1 AND friend_id = $2) OR (user_id = $3 AND friend_id = $4)`,
 		userID, friendID, friendID, userID,
 	).Scan(&friend.ID, &friend.UserID, &friend.FriendID, &friend.Status, &friend.CreatedAt)
 	if err != nil {
@@ -406,7 +652,7 @@ func GetFriendship(userID, friendID int64) (*models.Friend, error) {
 // AcceptFriendRequest accepts a pending friend request
 func AcceptFriendRequest(requestID int64, userID int64) error {
 	result, err := DB.Exec(
-		"UPDATE friends SET status = 'accepted' WHERE id = ? AND friend_id = ? AND status = 'pending'",
+		"UPDATE friends SET status = 'accepted' WHERE id = $1 AND friend_id = $2 AND status = 'pending'",
 		requestID, userID,
 	)
 	if err != nil {
@@ -426,8 +672,8 @@ func GetFriends(userID int64) ([]models.UserResponse, error) {
 		`SELECT u.id, u.username, u.email, u.avatar, u.created_at
 		FROM users u
 		JOIN friends f ON (f.user_id = u.id OR f.friend_id = u.id)
-		WHERE ((f.user_id = ? OR f.friend_id = ?) AND f.status = 'accepted')
-		  AND u.id != ?`,
+		WHERE ((f.user_id = $1 OR f.friend_id = $2) AND f.status = 'accepted')
+		  AND u.id != $3`,
 		userID, userID, userID,
 	)
 	if err != nil {
@@ -456,7 +702,7 @@ func GetPendingFriendRequests(userID int64) ([]models.FriendRequest, error) {
 		`SELECT f.id, u.id, u.username, u.email, u.avatar, u.created_at, f.status, f.created_at
 		FROM friends f
 		JOIN users u ON f.user_id = u.id
-		WHERE f.friend_id = ? AND f.status = 'pending'`,
+		WHERE f.friend_id = $1 AND f.status = 'pending'`,
 		userID,
 	)
 	if err != nil {
@@ -483,7 +729,7 @@ func GetPendingFriendRequests(userID int64) ([]models.FriendRequest, error) {
 // DeleteFriend removes a friendship
 func DeleteFriend(userID, friendID int64) error {
 	_, err := DB.Exec(
-		"DELETE FROM friends WHERE (user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)",
+		"DELETE FROM friends WHERE (user_id = $1 AND friend_id = $2) OR (user_id = $3 AND friend_id = $4)",
 		userID, friendID, friendID, userID,
 	)
 	return err
@@ -495,10 +741,9 @@ func DeleteFriend(userID, friendID int64) error {
 func GetAllUsers() ([]models.UserResponse, error) {
 	rows, err := DB.Query(`
 		SELECT u.id, u.username, u.email, u.avatar, u.created_at, 
-		       COALESCE(u.auth_method, 'email'), COALESCE(u.is_disabled, 0),
-		       CASE WHEN s.id IS NOT NULL THEN 1 ELSE 0 END as online
+		       COALESCE(u.auth_method, 'email'), COALESCE(u.is_disabled, FALSE),
+		       EXISTS(SELECT 1 FROM sessions s WHERE s.user_id = u.id AND s.expires_at > NOW()) as online
 		FROM users u
-		LEFT JOIN sessions s ON u.id = s.user_id AND s.expires_at > datetime('now')
 		ORDER BY u.created_at DESC
 	`)
 	if err != nil {
@@ -521,22 +766,24 @@ func GetAllUsers() ([]models.UserResponse, error) {
 
 // DisableUser disables or enables a user account
 func DisableUser(userID int64, disabled bool) error {
-	disabledInt := 0
-	if disabled {
-		disabledInt = 1
-	}
-	_, err := DB.Exec("UPDATE users SET is_disabled = ? WHERE id = ?", disabledInt, userID)
+	_, err := DB.Exec("UPDATE users SET is_disabled = $1 WHERE id = $2", disabled, userID)
 	return err
 }
 
 // ResetUserPassword resets a user's password
 func ResetUserPassword(userID int64, newPassword string) error {
-	_, err := DB.Exec("UPDATE users SET password = ? WHERE id = ?", newPassword, userID)
+	_, err := DB.Exec("UPDATE users SET password = $1 WHERE id = $2", newPassword, userID)
 	return err
 }
 
 // DeleteAllUserSessions deletes all sessions for a user (force logout)
 func DeleteAllUserSessions(userID int64) error {
-	_, err := DB.Exec("DELETE FROM sessions WHERE user_id = ?", userID)
+	_, err := DB.Exec("DELETE FROM sessions WHERE user_id = $1", userID)
+	return err
+}
+
+// SetUserAdmin grants or revokes admin rights
+func SetUserAdmin(userID int64, admin bool) error {
+	_, err := DB.Exec("UPDATE users SET is_admin = $1 WHERE id = $2", admin, userID)
 	return err
 }
@@ -0,0 +1,92 @@
+package database
+
+import "database/sql"
+
+const deletionSchema = `
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+	CREATE TABLE IF NOT EXISTS message_hidden (
+		message_id BIGINT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+		user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (message_id, user_id)
+	);
+`
+
+// Deletion queries
+
+// HideMessageForUser removes a message from one user's view only
+func HideMessageForUser(messageID, userID int64) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		"INSERT INTO message_hidden (message_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		messageID, userID,
+	); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(
+		"DELETE FROM message_stars WHERE message_id = $1 AND user_id = $2",
+		messageID, userID,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// IsMessageHidden reports whether userID removed a message from their view
+func IsMessageHidden(messageID, userID int64) (bool, error) {
+	var hidden bool
+	err := DB.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM message_hidden WHERE message_id = $1 AND user_id = $2)",
+		messageID, userID,
+	).Scan(&hidden)
+	return hidden, err
+}
+
+// UnsendMessage wipes a message for everyone. The row stays behind as a
+// tombstone so ordering and replies that point at it keep working.
+func UnsendMessage(messageID int64) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := unsendMessage(tx, messageID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func unsendMessage(tx *sql.Tx, messageID int64) error {
+	if _, err := tx.Exec(
+		`UPDATE messages SET content = '', content_html = NULL, deleted_at = NOW(),
+			purge_at = CASE WHEN type = 'snap' THEN NOW() ELSE purge_at END
+		WHERE id = $1 AND deleted_at IS NULL`,
+		messageID,
+	); err != nil {
+		return err
+	}
+
+	// Old versions would otherwise still reveal the content
+	if _, err := tx.Exec("DELETE FROM message_revisions WHERE message_id = $1", messageID); err != nil {
+		return err
+	}
+
+	// A tombstone has nothing left worth pinning
+	if _, err := tx.Exec("DELETE FROM message_pins WHERE message_id = $1", messageID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM message_stars WHERE message_id = $1", messageID); err != nil {
+		return err
+	}
+
+	return nil
+}
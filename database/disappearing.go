@@ -0,0 +1,228 @@
+package database
+
+import (
+	"database/sql"
+
+	"scuffedsnap/models"
+)
+
+const disappearingSchema = `
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS expire_after_read INTEGER;
+
+	CREATE TABLE IF NOT EXISTS disappearing_timers (
+		user_a BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		user_b BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		ttl_seconds INTEGER NOT NULL CHECK (ttl_seconds > 0),
+		after_read BOOLEAN NOT NULL DEFAULT FALSE,
+		updated_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_a, user_b),
+		CHECK (user_a <= user_b)
+	);
+
+	CREATE TABLE IF NOT EXISTS disappearing_timer_proposals (
+		user_a BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		user_b BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		proposed_by BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		ttl_seconds INTEGER NOT NULL CHECK (ttl_seconds > 0),
+		after_read BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_a, user_b),
+		CHECK (user_a <= user_b)
+	);
+`
+
+// disappearingPair matches the rows of the conversation between $1 and $2
+const disappearingPair = "user_a = LEAST($1::BIGINT, $2::BIGINT) AND user_b = GREATEST($1::BIGINT, $2::BIGINT)"
+
+// disappearingTimerQuery looks up the timer of the conversation between $1
+// and $2. Conversations without a row have disappearing messages off.
+const disappearingTimerQuery = `SELECT ttl_seconds, after_read, updated_by, updated_at
+	FROM disappearing_timers WHERE ` + disappearingPair
+
+func scanDisappearingTimer(row *sql.Row) (*models.DisappearingTimer, error) {
+	var t models.DisappearingTimer
+	err := row.Scan(&t.Seconds, &t.AfterRead, &t.UpdatedBy, &t.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return &models.DisappearingTimer{Timer: models.DisappearingOff}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.SetName()
+	return &t, nil
+}
+
+// Disappearing timer queries
+
+// GetDisappearingTimer retrieves the disappearing message timer of the
+// conversation between two users, along with any change waiting for a
+// participant to accept it
+func GetDisappearingTimer(userID, otherUserID int64) (*models.DisappearingTimer, error) {
+	timer, err := scanDisappearingTimer(DB.QueryRow(disappearingTimerQuery, userID, otherUserID))
+	if err != nil {
+		return nil, err
+	}
+
+	proposal := models.DisappearingProposal{}
+	err = DB.QueryRow(
+		"SELECT proposed_by, ttl_seconds, after_read, created_at FROM disappearing_timer_proposals WHERE "+disappearingPair,
+		userID, otherUserID,
+	).Scan(&proposal.ProposedBy, &proposal.Seconds, &proposal.AfterRead, &proposal.CreatedAt)
+	if err == sql.ErrNoRows {
+		return timer, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	proposal.SetName()
+	timer.Pending = &proposal
+	return timer, nil
+}
+
+// AreConnected reports whether two users are friends or have already
+// exchanged messages
+func AreConnected(userID, otherUserID int64) (bool, error) {
+	var connected bool
+	err := DB.QueryRow(
+		`SELECT EXISTS (
+			SELECT 1 FROM friends
+			WHERE ((user_id = $1 AND friend_id = $2) OR (user_id = $2 AND friend_id = $1)) AND status = 'accepted'
+		) OR EXISTS (
+			SELECT 1 FROM messages
+			WHERE (sender_id = $1 AND receiver_id = $2) OR (sender_id = $2 AND receiver_id = $1)
+		)`,
+		userID, otherUserID,
+	).Scan(&connected)
+	return connected, err
+}
+
+// SetDisappearingTimer changes the timer of the conversation between userID
+// and otherUserID right away, dropping any pending proposal, and posts
+// notice into it as a system message from userID, which it returns
+func SetDisappearingTimer(userID, otherUserID int64, timer *models.DisappearingTimer, notice string) (*models.Message, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM disappearing_timer_proposals WHERE "+disappearingPair, userID, otherUserID); err != nil {
+		return nil, err
+	}
+	if err := saveDisappearingTimer(tx, userID, otherUserID, timer); err != nil {
+		return nil, err
+	}
+	return commitSystemMessage(tx, userID, otherUserID, notice)
+}
+
+// ProposeDisappearingTimer records that userID wants timer for the
+// conversation with otherUserID, replacing any earlier proposal, and posts
+// notice into it as a system message from userID, which it returns. The
+// timer only changes once otherUserID accepts.
+func ProposeDisappearingTimer(userID, otherUserID int64, timer *models.DisappearingTimer, notice string) (*models.Message, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`INSERT INTO disappearing_timer_proposals (user_a, user_b, proposed_by, ttl_seconds, after_read)
+		VALUES (LEAST($1::BIGINT, $2::BIGINT), GREATEST($1::BIGINT, $2::BIGINT), $1, $3, $4)
+		ON CONFLICT (user_a, user_b) DO UPDATE SET
+			proposed_by = EXCLUDED.proposed_by, ttl_seconds = EXCLUDED.ttl_seconds,
+			after_read = EXCLUDED.after_read, created_at = NOW()`,
+		userID, otherUserID, timer.Seconds, timer.AfterRead,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return commitSystemMessage(tx, userID, otherUserID, notice)
+}
+
+// AcceptDisappearingTimer applies otherUserID's pending proposal of timer to
+// their conversation with userID and posts notice into it as a system
+// message from userID, which it returns. It returns sql.ErrNoRows if
+// otherUserID has not proposed that timer.
+func AcceptDisappearingTimer(userID, otherUserID int64, timer *models.DisappearingTimer, notice string) (*models.Message, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"DELETE FROM disappearing_timer_proposals WHERE "+disappearingPair+" AND proposed_by = $2 AND ttl_seconds = $3 AND after_read = $4",
+		userID, otherUserID, timer.Seconds, timer.AfterRead,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	if err := saveDisappearingTimer(tx, userID, otherUserID, timer); err != nil {
+		return nil, err
+	}
+	return commitSystemMessage(tx, userID, otherUserID, notice)
+}
+
+// DeclineDisappearingTimer drops the pending proposal of the conversation
+// between userID and otherUserID, whoever made it, and posts notice into it
+// as a system message from userID, which it returns. It returns
+// sql.ErrNoRows if nothing is pending.
+func DeclineDisappearingTimer(userID, otherUserID int64, notice string) (*models.Message, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM disappearing_timer_proposals WHERE "+disappearingPair, userID, otherUserID)
+	if err != nil {
+		return nil, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return commitSystemMessage(tx, userID, otherUserID, notice)
+}
+
+// saveDisappearingTimer stores timer as the one userID set for the
+// conversation with otherUserID
+func saveDisappearingTimer(tx *sql.Tx, userID, otherUserID int64, timer *models.DisappearingTimer) error {
+	if timer.Timer == models.DisappearingOff {
+		_, err := tx.Exec("DELETE FROM disappearing_timers WHERE "+disappearingPair, userID, otherUserID)
+		return err
+	}
+	_, err := tx.Exec(
+		`INSERT INTO disappearing_timers (user_a, user_b, ttl_seconds, after_read, updated_by)
+		VALUES (LEAST($1::BIGINT, $2::BIGINT), GREATEST($1::BIGINT, $2::BIGINT), $3, $4, $1)
+		ON CONFLICT (user_a, user_b) DO UPDATE SET
+			ttl_seconds = EXCLUDED.ttl_seconds, after_read = EXCLUDED.after_read,
+			updated_by = EXCLUDED.updated_by, updated_at = NOW()`,
+		userID, otherUserID, timer.Seconds, timer.AfterRead,
+	)
+	return err
+}
+
+// commitSystemMessage posts notice from userID to otherUserID, commits tx
+// and returns the message
+func commitSystemMessage(tx *sql.Tx, userID, otherUserID int64, notice string) (*models.Message, error) {
+	var id int64
+	if err := tx.QueryRow(
+		`INSERT INTO messages (sender_id, receiver_id, content, type, format)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		userID, otherUserID, notice, models.MessageTypeSystem, models.MessageFormatPlain,
+	).Scan(&id); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return GetMessageByID(id)
+}
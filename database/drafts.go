@@ -0,0 +1,87 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"scuffedsnap/models"
+)
+
+const draftsSchema = `
+	CREATE TABLE IF NOT EXISTS drafts (
+		user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		other_user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		content TEXT NOT NULL DEFAULT '',
+		updated_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (user_id, other_user_id)
+	);
+`
+
+// Draft queries
+
+// SaveDraft stores a draft unless a newer version already exists, and
+// returns whichever version won along with whether it was this one.
+// Clearing a draft is saving empty content, so a stale save from another
+// device cannot bring it back.
+func SaveDraft(userID, otherUserID int64, content string, updatedAt time.Time) (*models.Draft, bool, error) {
+	draft := &models.Draft{}
+	err := DB.QueryRow(
+		`INSERT INTO drafts (user_id, other_user_id, content, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, other_user_id) DO UPDATE
+			SET content = EXCLUDED.content, updated_at = EXCLUDED.updated_at
+			WHERE drafts.updated_at < EXCLUDED.updated_at
+		RETURNING other_user_id, content, updated_at`,
+		userID, otherUserID, content, updatedAt,
+	).Scan(&draft.OtherUserID, &draft.Content, &draft.UpdatedAt)
+	if err == nil {
+		return draft, true, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, false, err
+	}
+
+	// Nothing returned means the stored draft is newer
+	current, err := GetDraft(userID, otherUserID)
+	if err != nil {
+		return nil, false, err
+	}
+	return current, false, nil
+}
+
+// GetDraft retrieves a user's draft for one conversation
+func GetDraft(userID, otherUserID int64) (*models.Draft, error) {
+	draft := &models.Draft{}
+	err := DB.QueryRow(
+		"SELECT other_user_id, content, updated_at FROM drafts WHERE user_id = $1 AND other_user_id = $2",
+		userID, otherUserID,
+	).Scan(&draft.OtherUserID, &draft.Content, &draft.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return draft, nil
+}
+
+// GetDrafts retrieves a user's non-empty drafts, most recent first
+func GetDrafts(userID int64) ([]models.Draft, error) {
+	rows, err := DB.Query(
+		`SELECT other_user_id, content, updated_at FROM drafts
+		WHERE user_id = $1 AND content <> ''
+		ORDER BY updated_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var drafts []models.Draft
+	for rows.Next() {
+		var d models.Draft
+		if err := rows.Scan(&d.OtherUserID, &d.Content, &d.UpdatedAt); err != nil {
+			return nil, err
+		}
+		drafts = append(drafts, d)
+	}
+	return drafts, rows.Err()
+}
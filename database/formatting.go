@@ -0,0 +1,6 @@
+package database
+
+const formattingSchema = `
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS format TEXT DEFAULT 'plain';
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS content_html TEXT;
+`
@@ -0,0 +1,7 @@
+package database
+
+const forwardingSchema = `
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS forwarded_from_message_id BIGINT REFERENCES messages(id) ON DELETE SET NULL;
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS forwarded_from_sender_id BIGINT REFERENCES users(id) ON DELETE SET NULL;
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS forwarded_from_receiver_id BIGINT REFERENCES users(id) ON DELETE SET NULL;
+`
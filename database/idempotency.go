@@ -0,0 +1,61 @@
+package database
+
+import (
+	"time"
+
+	"scuffedsnap/models"
+)
+
+const idempotencySchema = `
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS client_msg_id TEXT;
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_client_msg_id ON messages(sender_id, client_msg_id) WHERE client_msg_id IS NOT NULL;
+`
+
+// Idempotency queries
+
+// GetMessageByClientMsgID finds the message a sender created with
+// clientMsgID within window. An older use of the ID is released first, so
+// clients may reuse IDs once the window has passed.
+func GetMessageByClientMsgID(senderID int64, clientMsgID string, window time.Duration) (*models.Message, error) {
+	if _, err := DB.Exec(
+		`UPDATE messages SET client_msg_id = NULL
+		WHERE sender_id = $1 AND client_msg_id = $2 AND created_at <= NOW() - $3 * INTERVAL '1 second'`,
+		senderID, clientMsgID, window.Seconds(),
+	); err != nil {
+		return nil, err
+	}
+
+	msg := &models.Message{}
+	err := scanMessage(DB.QueryRow(
+		"SELECT "+messageColumns+" FROM messages m WHERE m.sender_id = $1 AND m.client_msg_id = $2",
+		senderID, clientMsgID,
+	), msg)
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// GetScheduledMessageByClientMsgID finds the pending scheduled message a
+// sender created with clientMsgID within window. Like
+// GetMessageByClientMsgID, an older use of the ID is released first.
+func GetScheduledMessageByClientMsgID(senderID int64, clientMsgID string, window time.Duration) (*models.ScheduledMessage, error) {
+	if _, err := DB.Exec(
+		`UPDATE scheduled_messages SET client_msg_id = NULL
+		WHERE sender_id = $1 AND client_msg_id = $2 AND created_at <= NOW() - $3 * INTERVAL '1 second'`,
+		senderID, clientMsgID, window.Seconds(),
+	); err != nil {
+		return nil, err
+	}
+
+	var s models.ScheduledMessage
+	err := scanScheduledMessage(DB.QueryRow(
+		"SELECT "+scheduledColumns+" FROM scheduled_messages WHERE sender_id = $1 AND client_msg_id = $2",
+		senderID, clientMsgID,
+	), &s)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
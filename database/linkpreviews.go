@@ -0,0 +1,86 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"scuffedsnap/models"
+)
+
+const linkPreviewsSchema = `
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS link_preview JSONB;
+
+	CREATE TABLE IF NOT EXISTS link_previews (
+		url TEXT PRIMARY KEY,
+		title TEXT,
+		description TEXT,
+		image_url TEXT,
+		site_name TEXT,
+		failed BOOLEAN DEFAULT FALSE,
+		fetched_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+`
+
+// Link preview queries
+
+// GetCachedLinkPreview returns the cached preview of url if it was fetched
+// within maxAge. A nil preview means the last fetch failed. It returns
+// sql.ErrNoRows when there is no fresh cache entry.
+func GetCachedLinkPreview(url string, maxAge time.Duration) (*models.LinkPreview, error) {
+	var p models.LinkPreview
+	var failed bool
+	var description, imageURL, siteName sql.NullString
+	err := DB.QueryRow(
+		`SELECT url, COALESCE(title, ''), description, image_url, site_name, failed
+		FROM link_previews
+		WHERE url = $1 AND fetched_at > NOW() - $2 * INTERVAL '1 second'`,
+		url, maxAge.Seconds(),
+	).Scan(&p.URL, &p.Title, &description, &imageURL, &siteName, &failed)
+	if err != nil {
+		return nil, err
+	}
+	if failed {
+		return nil, nil
+	}
+	p.Description = description.String
+	p.ImageURL = imageURL.String
+	p.SiteName = siteName.String
+	return &p, nil
+}
+
+// CacheLinkPreview stores the result of fetching url; nil records a failure
+func CacheLinkPreview(url string, p *models.LinkPreview) error {
+	var title, description, imageURL, siteName string
+	if p != nil {
+		title, description, imageURL, siteName = p.Title, p.Description, p.ImageURL, p.SiteName
+	}
+
+	_, err := DB.Exec(
+		`INSERT INTO link_previews (url, title, description, image_url, site_name, failed, fetched_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		ON CONFLICT (url) DO UPDATE SET
+			title = EXCLUDED.title, description = EXCLUDED.description, image_url = EXCLUDED.image_url,
+			site_name = EXCLUDED.site_name, failed = EXCLUDED.failed, fetched_at = EXCLUDED.fetched_at`,
+		url, title, description, imageURL, siteName, p == nil,
+	)
+	return err
+}
+
+// SetMessageLinkPreview attaches the preview of url to a message. It reports
+// false if the message was deleted or edited to no longer contain url.
+func SetMessageLinkPreview(messageID int64, url string, p *models.LinkPreview) (bool, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return false, err
+	}
+	result, err := DB.Exec(
+		"UPDATE messages SET link_preview = $2 WHERE id = $1 AND deleted_at IS NULL AND strpos(content, $3) > 0",
+		messageID, data, url,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
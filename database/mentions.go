@@ -0,0 +1,67 @@
+package database
+
+import (
+	"scuffedsnap/models"
+)
+
+const mentionsSchema = `
+	CREATE TABLE IF NOT EXISTS message_mentions (
+		message_id BIGINT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+		user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (message_id, user_id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_message_mentions_user ON message_mentions(user_id);
+`
+
+// Mention queries
+
+// CreateMentions records the users mentioned in a message
+func CreateMentions(messageID int64, userIDs []int64) error {
+	for _, userID := range userIDs {
+		if _, err := DB.Exec(
+			"INSERT INTO message_mentions (message_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+			messageID, userID,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetMentionsForUser retrieves visible messages that mention a user, newest first
+func GetMentionsForUser(userID int64, limit, offset int) ([]models.MessageWithSender, error) {
+	rows, err := DB.Query(
+		`SELECT `+messageColumns+`, u.username, u.avatar, `+replyPreviewColumns+`
+		FROM message_mentions mn
+		JOIN messages m ON mn.message_id = m.id
+		JOIN users u ON m.sender_id = u.id
+		`+replyPreviewJoin+`
+		WHERE mn.user_id = $1
+		  AND m.deleted_at IS NULL
+		  AND (m.expires_at IS NULL OR m.expires_at > NOW())
+		  AND NOT EXISTS (SELECT 1 FROM message_hidden h WHERE h.message_id = m.id AND h.user_id = $1)
+		ORDER BY m.created_at DESC
+		LIMIT $2 OFFSET $3`,
+		userID, limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []models.MessageWithSender
+	for rows.Next() {
+		msg, err := scanMessageWithSender(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *msg)
+	}
+
+	if err := prepareMessages(messages, userID); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"database/sql"
+
+	"scuffedsnap/models"
+)
+
+const pinsSchema = `
+	CREATE TABLE IF NOT EXISTS message_pins (
+		message_id BIGINT PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+		pinned_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+		pinned_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+`
+
+// Pin queries
+
+// PinMessage pins a message in its conversation unless the conversation
+// already has limit live pins. It reports false if the message was already
+// pinned, and returns sql.ErrNoRows if the limit was reached. Pins in one
+// conversation are serialized, so concurrent requests cannot overshoot it.
+func PinMessage(messageID, userID int64, limit int) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`SELECT pg_advisory_xact_lock(hashtextextended(
+			'message_pins:' || LEAST(sender_id, receiver_id) || ':' || GREATEST(sender_id, receiver_id), 0))
+		FROM messages WHERE id = $1`,
+		messageID,
+	); err != nil {
+		return false, err
+	}
+
+	var pinned bool
+	if err := tx.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM message_pins WHERE message_id = $1)", messageID,
+	).Scan(&pinned); err != nil {
+		return false, err
+	}
+	if pinned {
+		return false, nil
+	}
+
+	result, err := tx.Exec(
+		`INSERT INTO message_pins (message_id, pinned_by)
+		SELECT t.id, $2 FROM messages t
+		WHERE t.id = $1 AND (
+			SELECT COUNT(*) FROM message_pins pin
+			JOIN messages m ON pin.message_id = m.id
+			WHERE ((m.sender_id = t.sender_id AND m.receiver_id = t.receiver_id)
+				OR (m.sender_id = t.receiver_id AND m.receiver_id = t.sender_id))
+			  AND m.deleted_at IS NULL
+			  AND (m.expires_at IS NULL OR m.expires_at > NOW())
+		) < $3`,
+		messageID, userID, limit,
+	)
+	if err != nil {
+		return false, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return false, sql.ErrNoRows
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// UnpinMessage removes a pin. It reports false if the message was not pinned.
+func UnpinMessage(messageID int64) (bool, error) {
+	result, err := DB.Exec("DELETE FROM message_pins WHERE message_id = $1", messageID)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// GetPinnedMessages retrieves the pinned messages between two users that
+// userID can see, most recently pinned first
+func GetPinnedMessages(userID, otherUserID int64) ([]models.MessageWithSender, error) {
+	rows, err := DB.Query(
+		`SELECT `+messageColumns+`, u.username, u.avatar, `+replyPreviewColumns+`
+		FROM message_pins pin
+		JOIN messages m ON pin.message_id = m.id
+		JOIN users u ON m.sender_id = u.id
+		`+replyPreviewJoin+`
+		WHERE ((m.sender_id = $1 AND m.receiver_id = $2) OR (m.sender_id = $2 AND m.receiver_id = $1))
+		  AND m.deleted_at IS NULL
+		  AND (m.expires_at IS NULL OR m.expires_at > NOW())
+		  AND NOT EXISTS (SELECT 1 FROM message_hidden h WHERE h.message_id = m.id AND h.user_id = $1)
+		ORDER BY pin.pinned_at DESC`,
+		userID, otherUserID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []models.MessageWithSender
+	for rows.Next() {
+		msg, err := scanMessageWithSender(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *msg)
+	}
+
+	if err := prepareMessages(messages, userID); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
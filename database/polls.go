@@ -0,0 +1,272 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+
+	"scuffedsnap/models"
+)
+
+const pollsSchema = `
+	CREATE TABLE IF NOT EXISTS polls (
+		message_id BIGINT PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+		multiple_choice BOOLEAN DEFAULT FALSE,
+		anonymous BOOLEAN DEFAULT FALSE,
+		closes_at TIMESTAMP,
+		closed_at TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS poll_options (
+		id BIGSERIAL PRIMARY KEY,
+		message_id BIGINT NOT NULL REFERENCES polls(message_id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		text TEXT NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS poll_votes (
+		option_id BIGINT NOT NULL REFERENCES poll_options(id) ON DELETE CASCADE,
+		message_id BIGINT NOT NULL REFERENCES polls(message_id) ON DELETE CASCADE,
+		user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (option_id, user_id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_poll_options_message ON poll_options(message_id, position);
+	CREATE INDEX IF NOT EXISTS idx_poll_votes_message ON poll_votes(message_id, user_id);
+`
+
+// NewPoll holds the settings of a poll created along with its message
+type NewPoll struct {
+	Options        []string
+	MultipleChoice bool
+	Anonymous      bool
+	ClosesAt       *time.Time
+}
+
+// pollOpen is the condition for a poll "p" still accepting votes
+const pollOpen = "p.closed_at IS NULL AND (p.closes_at IS NULL OR p.closes_at > NOW())"
+
+// Poll queries
+
+func createPoll(tx *sql.Tx, messageID int64, poll *NewPoll) error {
+	if _, err := tx.Exec(
+		"INSERT INTO polls (message_id, multiple_choice, anonymous, closes_at) VALUES ($1, $2, $3, $4)",
+		messageID, poll.MultipleChoice, poll.Anonymous, poll.ClosesAt,
+	); err != nil {
+		return err
+	}
+
+	for i, option := range poll.Options {
+		if _, err := tx.Exec(
+			"INSERT INTO poll_options (message_id, position, text) VALUES ($1, $2, $3)",
+			messageID, i, option,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetPolls loads the polls of a set of messages from the point of view of
+// viewerID, keyed by message ID
+func GetPolls(messageIDs []int64, viewerID int64) (map[int64]*models.Poll, error) {
+	polls := make(map[int64]*models.Poll)
+	if len(messageIDs) == 0 {
+		return polls, nil
+	}
+
+	rows, err := DB.Query(
+		`SELECT p.message_id, p.multiple_choice, p.anonymous, p.closes_at, NOT (`+pollOpen+`),
+			(SELECT COUNT(DISTINCT v.user_id) FROM poll_votes v WHERE v.message_id = p.message_id)
+		FROM polls p
+		WHERE p.message_id = ANY($1)`,
+		pq.Array(messageIDs),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID int64
+		poll := &models.Poll{Options: []models.PollOption{}}
+		if err := rows.Scan(&messageID, &poll.MultipleChoice, &poll.Anonymous, &poll.ClosesAt, &poll.Closed, &poll.TotalVoters); err != nil {
+			return nil, err
+		}
+		polls[messageID] = poll
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	optionRows, err := DB.Query(
+		`SELECT o.message_id, o.id, o.text,
+			ARRAY(SELECT v.user_id FROM poll_votes v WHERE v.option_id = o.id ORDER BY v.created_at)
+		FROM poll_options o
+		WHERE o.message_id = ANY($1)
+		ORDER BY o.message_id, o.position`,
+		pq.Array(messageIDs),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer optionRows.Close()
+
+	for optionRows.Next() {
+		var messageID int64
+		var option models.PollOption
+		var voters []int64
+		if err := optionRows.Scan(&messageID, &option.ID, &option.Text, pq.Array(&voters)); err != nil {
+			return nil, err
+		}
+
+		poll, ok := polls[messageID]
+		if !ok {
+			continue
+		}
+		option.Votes = len(voters)
+		for _, voter := range voters {
+			if voter == viewerID {
+				option.VotedByMe = true
+			}
+		}
+		if !poll.Anonymous {
+			option.Voters = voters
+		}
+		poll.Options = append(poll.Options, option)
+	}
+	return polls, optionRows.Err()
+}
+
+// GetPoll loads one poll from the point of view of viewerID
+func GetPoll(messageID, viewerID int64) (*models.Poll, error) {
+	polls, err := GetPolls([]int64{messageID}, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	poll, ok := polls[messageID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return poll, nil
+}
+
+// attachPolls fills in Poll on each poll message for viewerID
+func attachPolls(messages []models.MessageWithSender, viewerID int64) error {
+	var ids []int64
+	for i := range messages {
+		if messages[i].Type == models.MessageTypePoll {
+			ids = append(ids, messages[i].ID)
+		}
+	}
+
+	polls, err := GetPolls(ids, viewerID)
+	if err != nil {
+		return err
+	}
+
+	for i := range messages {
+		messages[i].Poll = polls[messages[i].ID]
+	}
+	return nil
+}
+
+// VotePoll records a vote for an option of an open poll. In single choice
+// polls it replaces the user's previous vote. It reports false if nothing
+// changed, and returns sql.ErrNoRows if the poll is closed or the option
+// does not belong to it.
+func VotePoll(messageID, optionID, userID int64) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Locking the poll row serializes votes against closing
+	var multipleChoice bool
+	err = tx.QueryRow(
+		`SELECT p.multiple_choice FROM polls p
+		JOIN poll_options o ON o.message_id = p.message_id AND o.id = $2
+		WHERE p.message_id = $1 AND `+pollOpen+`
+		FOR UPDATE OF p`,
+		messageID, optionID,
+	).Scan(&multipleChoice)
+	if err != nil {
+		return false, err
+	}
+
+	var removed int64
+	if !multipleChoice {
+		result, err := tx.Exec(
+			"DELETE FROM poll_votes WHERE message_id = $1 AND user_id = $2 AND option_id <> $3",
+			messageID, userID, optionID,
+		)
+		if err != nil {
+			return false, err
+		}
+		removed, _ = result.RowsAffected()
+	}
+
+	result, err := tx.Exec(
+		"INSERT INTO poll_votes (option_id, message_id, user_id) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING",
+		optionID, messageID, userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	added, _ := result.RowsAffected()
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return added > 0 || removed > 0, nil
+}
+
+// UnvotePoll removes a user's vote for an option of an open poll. It
+// reports false if there was no such vote and returns sql.ErrNoRows if the
+// poll is closed.
+func UnvotePoll(messageID, optionID, userID int64) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	if err := tx.QueryRow(
+		"SELECT p.message_id FROM polls p WHERE p.message_id = $1 AND "+pollOpen+" FOR UPDATE",
+		messageID,
+	).Scan(&id); err != nil {
+		return false, err
+	}
+
+	result, err := tx.Exec(
+		"DELETE FROM poll_votes WHERE message_id = $1 AND option_id = $2 AND user_id = $3",
+		messageID, optionID, userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	removed, _ := result.RowsAffected()
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return removed > 0, nil
+}
+
+// ClosePoll closes a poll early, locking its results. It reports false if
+// it was already closed.
+func ClosePoll(messageID int64) (bool, error) {
+	result, err := DB.Exec(
+		"UPDATE polls p SET closed_at = NOW() WHERE p.message_id = $1 AND "+pollOpen,
+		messageID,
+	)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"scuffedsnap/models"
+)
+
+// Kept apart from Supabase's push_subscriptions, whose user IDs are UUIDs
+const pushSchema = `
+	CREATE TABLE IF NOT EXISTS user_push_subscriptions (
+		endpoint TEXT PRIMARY KEY,
+		user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		p256dh TEXT NOT NULL,
+		auth TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_user_push_subscriptions_user ON user_push_subscriptions(user_id);
+`
+
+const pushSubscriptionColumns = "user_id, endpoint, p256dh, auth, created_at"
+
+// Push subscription queries
+
+// SavePushSubscription stores a browser's push endpoint for a user. An
+// endpoint belongs to one browser, so re-subscribing moves it to the new user.
+func SavePushSubscription(userID int64, endpoint, p256dh, auth string) error {
+	_, err := DB.Exec(
+		`INSERT INTO user_push_subscriptions (endpoint, user_id, p256dh, auth) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (endpoint) DO UPDATE
+			SET user_id = EXCLUDED.user_id, p256dh = EXCLUDED.p256dh, auth = EXCLUDED.auth`,
+		endpoint, userID, p256dh, auth,
+	)
+	return err
+}
+
+// DeleteUserPushSubscription removes one of a user's push endpoints
+func DeleteUserPushSubscription(userID int64, endpoint string) error {
+	_, err := DB.Exec(
+		"DELETE FROM user_push_subscriptions WHERE user_id = $1 AND endpoint = $2",
+		userID, endpoint,
+	)
+	return err
+}
+
+// DeletePushSubscription removes an endpoint the push service rejected
+func DeletePushSubscription(endpoint string) error {
+	_, err := DB.Exec("DELETE FROM user_push_subscriptions WHERE endpoint = $1", endpoint)
+	return err
+}
+
+// GetPushSubscriptions retrieves every push endpoint of a user
+func GetPushSubscriptions(userID int64) ([]models.PushSubscription, error) {
+	return queryPushSubscriptions(
+		"SELECT "+pushSubscriptionColumns+" FROM user_push_subscriptions WHERE user_id = $1",
+		userID,
+	)
+}
+
+// GetAllPushSubscriptions retrieves every stored push endpoint
+func GetAllPushSubscriptions() ([]models.PushSubscription, error) {
+	return queryPushSubscriptions("SELECT " + pushSubscriptionColumns + " FROM user_push_subscriptions")
+}
+
+func queryPushSubscriptions(query string, args ...interface{}) ([]models.PushSubscription, error) {
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []models.PushSubscription
+	for rows.Next() {
+		var s models.PushSubscription
+		if err := rows.Scan(&s.UserID, &s.Endpoint, &s.P256dh, &s.Auth, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		subs = append(subs, s)
+	}
+	return subs, nil
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"github.com/lib/pq"
+
+	"scuffedsnap/models"
+)
+
+const reactionsSchema = `
+	CREATE TABLE IF NOT EXISTS message_reactions (
+		message_id BIGINT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+		user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		emoji TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (message_id, user_id, emoji)
+	);
+`
+
+// Reaction queries
+
+// AddReaction records a user's reaction. It reports false if the user had
+// already reacted with that emoji.
+func AddReaction(messageID, userID int64, emoji string) (bool, error) {
+	result, err := DB.Exec(
+		"INSERT INTO message_reactions (message_id, user_id, emoji) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING",
+		messageID, userID, emoji,
+	)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// RemoveReaction deletes a user's reaction. It reports false if there was none.
+func RemoveReaction(messageID, userID int64, emoji string) (bool, error) {
+	result, err := DB.Exec(
+		"DELETE FROM message_reactions WHERE message_id = $1 AND user_id = $2 AND emoji = $3",
+		messageID, userID, emoji,
+	)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// GetReactionSummaries aggregates reactions for a set of messages from the
+// point of view of viewerID, keyed by message ID
+func GetReactionSummaries(messageIDs []int64, viewerID int64) (map[int64][]models.ReactionSummary, error) {
+	summaries := make(map[int64][]models.ReactionSummary)
+	if len(messageIDs) == 0 {
+		return summaries, nil
+	}
+
+	rows, err := DB.Query(
+		`SELECT message_id, emoji, COUNT(*), BOOL_OR(user_id = $2)
+		FROM message_reactions
+		WHERE message_id = ANY($1)
+		GROUP BY message_id, emoji
+		ORDER BY message_id, MIN(created_at)`,
+		pq.Array(messageIDs), viewerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID int64
+		var summary models.ReactionSummary
+		if err := rows.Scan(&messageID, &summary.Emoji, &summary.Count, &summary.ReactedByMe); err != nil {
+			return nil, err
+		}
+		summaries[messageID] = append(summaries[messageID], summary)
+	}
+	return summaries, nil
+}
+
+// attachReactions fills in Reactions on each message for viewerID
+func attachReactions(messages []models.MessageWithSender, viewerID int64) error {
+	ids := make([]int64, len(messages))
+	for i := range messages {
+		ids[i] = messages[i].ID
+	}
+
+	summaries, err := GetReactionSummaries(ids, viewerID)
+	if err != nil {
+		return err
+	}
+
+	for i := range messages {
+		messages[i].Reactions = summaries[messages[i].ID]
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package database
+
+import (
+	"github.com/lib/pq"
+
+	"scuffedsnap/models"
+)
+
+const receiptsSchema = `
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS delivered_at TIMESTAMP;
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS send_read_receipts BOOLEAN DEFAULT TRUE;
+
+	CREATE TABLE IF NOT EXISTS read_watermarks (
+		user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		other_user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		last_read_message_id BIGINT NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, other_user_id)
+	);
+`
+
+// Receipt queries
+
+// MarkMessagesDelivered records that the receiver's client got the given
+// messages. It returns the IDs that changed grouped by sender.
+func MarkMessagesDelivered(messageIDs []int64, receiverID int64) (map[int64][]int64, error) {
+	rows, err := DB.Query(
+		`UPDATE messages SET delivered_at = NOW()
+		WHERE id = ANY($1) AND receiver_id = $2 AND delivered_at IS NULL
+		RETURNING id, sender_id`,
+		pq.Array(messageIDs), receiverID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bySender := make(map[int64][]int64)
+	for rows.Next() {
+		var id, senderID int64
+		if err := rows.Scan(&id, &senderID); err != nil {
+			return nil, err
+		}
+		bySender[senderID] = append(bySender[senderID], id)
+	}
+	return bySender, rows.Err()
+}
+
+// GetReadWatermark returns the newest message from otherUserID that userID
+// has read, or 0
+func GetReadWatermark(userID, otherUserID int64) (int64, error) {
+	var id int64
+	err := DB.QueryRow(
+		"SELECT last_read_message_id FROM read_watermarks WHERE user_id = $1 AND other_user_id = $2",
+		userID, otherUserID,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func updateReadWatermark(userID, otherUserID, messageID int64) error {
+	_, err := DB.Exec(
+		`INSERT INTO read_watermarks (user_id, other_user_id, last_read_message_id) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, other_user_id) DO UPDATE
+		SET last_read_message_id = GREATEST(read_watermarks.last_read_message_id, EXCLUDED.last_read_message_id),
+		    updated_at = NOW()`,
+		userID, otherUserID, messageID,
+	)
+	return err
+}
+
+// RedactReadReceipts applies each receiver's read receipt setting to
+// messages shown to viewerID. Everything that hands messages to a user goes
+// through here or RedactReadReceipt. If the settings cannot be read, read
+// information is hidden as if every receiver opted out.
+func RedactReadReceipts(messages []*models.Message, viewerID int64) error {
+	var receiverIDs []int64
+	for _, m := range messages {
+		if m.SenderID == viewerID && m.ReceiverID != viewerID && m.ReadAt != nil {
+			receiverIDs = append(receiverIDs, m.ReceiverID)
+		}
+	}
+	if len(receiverIDs) == 0 {
+		return nil
+	}
+
+	optedOut, err := readReceiptOptOuts(receiverIDs)
+	for _, m := range messages {
+		m.RedactReadReceipt(viewerID, err == nil && !optedOut[m.ReceiverID])
+	}
+	return err
+}
+
+// readReceiptOptOuts returns which of userIDs do not send read receipts
+func readReceiptOptOuts(userIDs []int64) (map[int64]bool, error) {
+	rows, err := DB.Query(
+		"SELECT id FROM users WHERE id = ANY($1) AND NOT COALESCE(send_read_receipts, TRUE)",
+		pq.Array(userIDs),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	optedOut := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		optedOut[id] = true
+	}
+	return optedOut, rows.Err()
+}
+
+// RedactReadReceipt applies the receiver's read receipt setting to one
+// message shown to viewerID
+func RedactReadReceipt(message *models.Message, viewerID int64) error {
+	return RedactReadReceipts([]*models.Message{message}, viewerID)
+}
+
+// SetSendReadReceipts updates a user's read receipt privacy setting
+func SetSendReadReceipts(userID int64, enabled bool) error {
+	_, err := DB.Exec("UPDATE users SET send_read_receipts = $1 WHERE id = $2", enabled, userID)
+	return err
+}
@@ -0,0 +1,189 @@
+package database
+
+import (
+	"database/sql"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+
+	"scuffedsnap/models"
+)
+
+const repliesSchema = `
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS replied_to_message_id BIGINT REFERENCES messages(id) ON DELETE SET NULL;
+
+	CREATE INDEX IF NOT EXISTS idx_messages_replied_to ON messages(replied_to_message_id);
+`
+
+// replyPreviewColumns selects the parent message of "m" through replyPreviewJoin.
+// The last column is whether the parent was unsent or has expired.
+const replyPreviewColumns = "p.id, p.sender_id, pu.username, p.content, p.type, " + parentGone
+
+const parentGone = "(p.deleted_at IS NOT NULL OR (p.expires_at IS NOT NULL AND p.expires_at <= NOW()))"
+
+const replyPreviewJoin = `LEFT JOIN messages p ON m.replied_to_message_id = p.id
+		LEFT JOIN users pu ON p.sender_id = pu.id`
+
+// previewLength is how many characters of the parent a reply preview shows
+const previewLength = 100
+
+// scanMessageWithSender scans messageColumns, the sender's username and
+// avatar, and replyPreviewColumns
+func scanMessageWithSender(row rowScanner) (*models.MessageWithSender, error) {
+	var msg models.MessageWithSender
+	var parentID, parentSenderID sql.NullInt64
+	var parentUsername, parentContent, parentType sql.NullString
+	var parentGone sql.NullBool
+
+	if err := scanMessage(row, &msg.Message, &msg.SenderUsername, &msg.SenderAvatar,
+		&parentID, &parentSenderID, &parentUsername, &parentContent, &parentType, &parentGone,
+	); err != nil {
+		return nil, err
+	}
+
+	msg.HideSnapContent()
+
+	if parentID.Valid {
+		msg.ReplyTo = &models.MessagePreview{
+			ID:             parentID.Int64,
+			SenderID:       parentSenderID.Int64,
+			SenderUsername: parentUsername.String,
+			Content:        truncatePreview(parentContent.String, parentType.String),
+			Type:           parentType.String,
+		}
+		if parentGone.Bool {
+			msg.ReplyTo.Tombstone()
+		}
+	}
+	return &msg, nil
+}
+
+// prepareMessages fills in everything about listed messages that depends
+// on who is looking at them
+func prepareMessages(messages []models.MessageWithSender, viewerID int64) error {
+	if err := attachReactions(messages, viewerID); err != nil {
+		return err
+	}
+	if err := attachPolls(messages, viewerID); err != nil {
+		return err
+	}
+	if err := hideReplyParents(messages, viewerID); err != nil {
+		return err
+	}
+
+	ptrs := make([]*models.Message, len(messages))
+	for i := range messages {
+		ptrs[i] = &messages[i].Message
+	}
+	return RedactReadReceipts(ptrs, viewerID)
+}
+
+// hideReplyParents turns reply previews of messages viewerID has hidden
+// into tombstones
+func hideReplyParents(messages []models.MessageWithSender, viewerID int64) error {
+	var ids []int64
+	for i := range messages {
+		if p := messages[i].ReplyTo; p != nil && !p.Deleted {
+			ids = append(ids, p.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rows, err := DB.Query(
+		"SELECT message_id FROM message_hidden WHERE user_id = $1 AND message_id = ANY($2)",
+		viewerID, pq.Array(ids),
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	hidden := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		hidden[id] = true
+	}
+
+	for i := range messages {
+		if p := messages[i].ReplyTo; p != nil && hidden[p.ID] {
+			p.Tombstone()
+		}
+	}
+	return rows.Err()
+}
+
+// Reply queries
+
+// GetMessagePreview builds the reply preview of a message as viewerID
+// sees it. Unsent, expired and hidden messages give a tombstone.
+func GetMessagePreview(messageID, viewerID int64) (*models.MessagePreview, error) {
+	preview := &models.MessagePreview{}
+	var gone bool
+	err := DB.QueryRow(
+		`SELECT p.id, p.sender_id, u.username, p.content, p.type,
+			`+parentGone+` OR EXISTS(SELECT 1 FROM message_hidden h WHERE h.message_id = p.id AND h.user_id = $2)
+		FROM messages p
+		JOIN users u ON p.sender_id = u.id
+		WHERE p.id = $1`,
+		messageID, viewerID,
+	).Scan(&preview.ID, &preview.SenderID, &preview.SenderUsername, &preview.Content, &preview.Type, &gone)
+	if err != nil {
+		return nil, err
+	}
+	preview.Content = truncatePreview(preview.Content, preview.Type)
+	if gone {
+		preview.Tombstone()
+	}
+	return preview, nil
+}
+
+// GetReplies retrieves every visible reply to a message, oldest first
+func GetReplies(messageID, viewerID int64) ([]models.MessageWithSender, error) {
+	rows, err := DB.Query(
+		`SELECT `+messageColumns+`, u.username, u.avatar, `+replyPreviewColumns+`
+		FROM messages m
+		JOIN users u ON m.sender_id = u.id
+		`+replyPreviewJoin+`
+		WHERE m.replied_to_message_id = $1
+		  AND (m.expires_at IS NULL OR m.expires_at > NOW())
+		  AND NOT EXISTS (SELECT 1 FROM message_hidden h WHERE h.message_id = m.id AND h.user_id = $2)
+		ORDER BY m.created_at ASC`,
+		messageID, viewerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var replies []models.MessageWithSender
+	for rows.Next() {
+		msg, err := scanMessageWithSender(rows)
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, *msg)
+	}
+
+	if err := prepareMessages(replies, viewerID); err != nil {
+		return nil, err
+	}
+	return replies, nil
+}
+
+// truncatePreview shortens content for a reply preview. Snap content is
+// never previewed.
+func truncatePreview(content, msgType string) string {
+	if msgType == models.MessageTypeSnap {
+		return ""
+	}
+	if utf8.RuneCountInString(content) <= previewLength {
+		return content
+	}
+	runes := []rune(content)
+	return string(runes[:previewLength]) + "..."
+}
@@ -0,0 +1,187 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"scuffedsnap/models"
+)
+
+const reportsSchema = `
+	CREATE TABLE IF NOT EXISTS reports (
+		id BIGSERIAL PRIMARY KEY,
+		reporter_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		reported_user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		message_id BIGINT REFERENCES messages(id) ON DELETE SET NULL,
+		message_content TEXT DEFAULT '',
+		message_type TEXT DEFAULT '',
+		message_created_at TIMESTAMP,
+		reason TEXT NOT NULL,
+		status TEXT DEFAULT 'open',
+		action TEXT DEFAULT '',
+		moderator_note TEXT DEFAULT '',
+		resolved_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+		resolved_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_reports_status ON reports(status);
+`
+
+const reportColumns = `id, reporter_id, reported_user_id, message_id, COALESCE(message_content, ''),
+	COALESCE(message_type, ''), message_created_at, reason, status, COALESCE(action, ''),
+	COALESCE(moderator_note, ''), resolved_by, resolved_at, created_at`
+
+func scanReport(row rowScanner) (*models.Report, error) {
+	report := &models.Report{}
+	err := row.Scan(
+		&report.ID, &report.ReporterID, &report.ReportedUserID, &report.MessageID, &report.MessageContent,
+		&report.MessageType, &report.MessageCreatedAt, &report.Reason, &report.Status, &report.Action,
+		&report.ModeratorNote, &report.ResolvedBy, &report.ResolvedAt, &report.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// Report queries
+
+// CreateReport files a report against a user. If msg is non-nil its content
+// is snapshotted into the report.
+func CreateReport(reporterID, reportedUserID int64, msg *models.Message, reason string) (*models.Report, error) {
+	var messageID *int64
+	var content, msgType string
+	var msgCreatedAt *time.Time
+	if msg != nil {
+		messageID = &msg.ID
+		content = msg.Content
+		msgType = msg.Type
+		msgCreatedAt = &msg.CreatedAt
+	}
+
+	var id int64
+	err := DB.QueryRow(
+		`INSERT INTO reports (reporter_id, reported_user_id, message_id, message_content, message_type, message_created_at, reason)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+		reporterID, reportedUserID, messageID, content, msgType, msgCreatedAt, reason,
+	).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	return GetReportByID(id)
+}
+
+// GetReportByID retrieves a report by its ID
+func GetReportByID(id int64) (*models.Report, error) {
+	return scanReport(DB.QueryRow("SELECT "+reportColumns+" FROM reports WHERE id = $1", id))
+}
+
+// GetReports retrieves reports in the given status, oldest first so the
+// queue is worked in order. An empty status returns every report.
+func GetReports(status models.ReportStatus, limit, offset int) ([]models.Report, error) {
+	rows, err := DB.Query(
+		"SELECT "+reportColumns+` FROM reports
+		WHERE ($1 = '' OR status = $1)
+		ORDER BY created_at ASC
+		LIMIT $2 OFFSET $3`,
+		string(status), limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []models.Report
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, *report)
+	}
+	return reports, nil
+}
+
+// GetReportsByReporter retrieves the reports a user filed, newest first
+func GetReportsByReporter(reporterID int64, limit, offset int) ([]models.Report, error) {
+	rows, err := DB.Query(
+		"SELECT "+reportColumns+` FROM reports
+		WHERE reporter_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3`,
+		reporterID, limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []models.Report
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, *report)
+	}
+	return reports, nil
+}
+
+// ResolveReport closes an open report with the moderator's decision. The
+// report is claimed and the action's database changes and audit entry are
+// written in one transaction, so concurrent resolves cannot both act and a
+// failure leaves the report open with nothing changed. Notifying users is
+// left to the caller. It returns sql.ErrNoRows if the report is not open.
+func ResolveReport(reportID, moderatorID int64, status models.ReportStatus, action, note string) (*models.Report, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	report, err := scanReport(tx.QueryRow(
+		`UPDATE reports SET status = $1, action = $2, moderator_note = $3, resolved_by = $4, resolved_at = NOW()
+		WHERE id = $5 AND status = 'open'
+		RETURNING `+reportColumns,
+		string(status), action, note, moderatorID, reportID,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	auditAction := "report.dismiss"
+	switch action {
+	case models.ReportActionDeleteMessage:
+		auditAction = "message.delete"
+		if report.MessageID != nil {
+			if err := unsendMessage(tx, *report.MessageID); err != nil {
+				return nil, err
+			}
+		}
+	case models.ReportActionWarn:
+		auditAction = "user.warn"
+	case models.ReportActionDisableUser:
+		auditAction = "user.disable"
+		if _, err := tx.Exec("UPDATE users SET is_disabled = TRUE WHERE id = $1", report.ReportedUserID); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = $1", report.ReportedUserID); err != nil {
+			return nil, err
+		}
+	}
+
+	details := fmt.Sprintf("report %d", report.ID)
+	if note != "" {
+		details += ": " + note
+	}
+	if _, err := tx.Exec(insertAuditLog, moderatorID, auditAction, report.ReportedUserID, details); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"time"
+
+	"scuffedsnap/models"
+)
+
+const revisionsSchema = `
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS edited BOOLEAN DEFAULT FALSE;
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP;
+
+	CREATE TABLE IF NOT EXISTS message_revisions (
+		id BIGSERIAL PRIMARY KEY,
+		message_id BIGINT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+		content TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_message_revisions_message ON message_revisions(message_id);
+`
+
+// Revision queries
+
+// EditMessage replaces the content of a message its sender wrote less than
+// window ago, keeping the old content as a revision. The window is checked
+// in the UPDATE itself, so an edit cannot slip in after it closes.
+// Mentions are replaced with the given user IDs, and clearLinkPreview drops
+// a preview that no longer matches the content. Returns sql.ErrNoRows if
+// the message is not editable.
+func EditMessage(messageID, senderID int64, content, contentHTML string, mentions []int64, clearLinkPreview bool, window time.Duration) (*models.Message, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// The FROM subquery sees the row as it was before the update
+	var oldContent string
+	err = tx.QueryRow(
+		`UPDATE messages m SET content = $1, content_html = $2, edited = TRUE, updated_at = NOW(),
+			link_preview = CASE WHEN $3 THEN NULL ELSE m.link_preview END
+		FROM (SELECT id, content FROM messages WHERE id = $4 FOR UPDATE) old
+		WHERE m.id = old.id AND m.sender_id = $5 AND m.deleted_at IS NULL
+		  AND m.created_at > NOW() - $6 * INTERVAL '1 second'
+		RETURNING old.content`,
+		content, contentHTML, clearLinkPreview, messageID, senderID, int64(window/time.Second),
+	).Scan(&oldContent)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(
+		"INSERT INTO message_revisions (message_id, content) VALUES ($1, $2)",
+		messageID, oldContent,
+	); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("DELETE FROM message_mentions WHERE message_id = $1", messageID); err != nil {
+		return nil, err
+	}
+	for _, userID := range mentions {
+		if _, err := tx.Exec(
+			"INSERT INTO message_mentions (message_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+			messageID, userID,
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return GetMessageByID(messageID)
+}
+
+// GetMessageRevisions retrieves the previous versions of a message, oldest first
+func GetMessageRevisions(messageID int64) ([]models.MessageRevision, error) {
+	rows, err := DB.Query(
+		`SELECT id, message_id, content, created_at FROM message_revisions
+		WHERE message_id = $1
+		ORDER BY created_at ASC, id ASC`,
+		messageID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []models.MessageRevision
+	for rows.Next() {
+		var rev models.MessageRevision
+		if err := rows.Scan(&rev.ID, &rev.MessageID, &rev.Content, &rev.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, nil
+}
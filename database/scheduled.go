@@ -0,0 +1,181 @@
+package database
+
+import (
+	"time"
+
+	"scuffedsnap/models"
+)
+
+const scheduledSchema = `
+	CREATE TABLE IF NOT EXISTS scheduled_messages (
+		id BIGSERIAL PRIMARY KEY,
+		sender_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		receiver_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		content TEXT NOT NULL,
+		type TEXT DEFAULT 'text',
+		format TEXT DEFAULT 'plain',
+		content_html TEXT,
+		replied_to_message_id BIGINT REFERENCES messages(id) ON DELETE SET NULL,
+		max_views INTEGER DEFAULT 1,
+		expire_seconds BIGINT,
+		send_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_scheduled_messages_send_at ON scheduled_messages(send_at);
+	CREATE INDEX IF NOT EXISTS idx_scheduled_messages_sender ON scheduled_messages(sender_id, send_at);
+
+	ALTER TABLE scheduled_messages ADD COLUMN IF NOT EXISTS client_msg_id TEXT;
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_scheduled_messages_client_msg_id
+		ON scheduled_messages(sender_id, client_msg_id) WHERE client_msg_id IS NOT NULL;
+`
+
+const scheduledColumns = `id, sender_id, receiver_id, content, type, format, COALESCE(content_html, ''), replied_to_message_id,
+	max_views, expire_seconds, send_at, created_at, updated_at, COALESCE(client_msg_id, '')`
+
+func scanScheduledMessage(row rowScanner, s *models.ScheduledMessage) error {
+	return row.Scan(
+		&s.ID, &s.SenderID, &s.ReceiverID, &s.Content, &s.Type, &s.Format, &s.ContentHTML, &s.RepliedToMessageID,
+		&s.MaxViews, &s.ExpireSeconds, &s.SendAt, &s.CreatedAt, &s.UpdatedAt, &s.ClientMsgID,
+	)
+}
+
+// Scheduled message queries
+
+// CreateScheduledMessage stores a message to be sent at s.SendAt. If
+// s.ClientMsgID is set and the sender already has a pending scheduled
+// message with that ID, it returns sql.ErrNoRows.
+func CreateScheduledMessage(s *models.ScheduledMessage) (*models.ScheduledMessage, error) {
+	if s.MaxViews < 1 {
+		s.MaxViews = 1
+	}
+	if s.Format == "" {
+		s.Format = models.MessageFormatPlain
+	}
+
+	var clientMsgID *string
+	if s.ClientMsgID != "" {
+		clientMsgID = &s.ClientMsgID
+	}
+
+	var created models.ScheduledMessage
+	err := scanScheduledMessage(DB.QueryRow(
+		`INSERT INTO scheduled_messages (sender_id, receiver_id, content, type, format, content_html,
+			replied_to_message_id, max_views, expire_seconds, send_at, client_msg_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (sender_id, client_msg_id) WHERE client_msg_id IS NOT NULL DO NOTHING
+		RETURNING `+scheduledColumns,
+		s.SenderID, s.ReceiverID, s.Content, s.Type, s.Format, s.ContentHTML,
+		s.RepliedToMessageID, s.MaxViews, s.ExpireSeconds, s.SendAt, clientMsgID,
+	), &created)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// GetScheduledMessage retrieves one of a sender's pending scheduled messages
+func GetScheduledMessage(id, senderID int64) (*models.ScheduledMessage, error) {
+	var s models.ScheduledMessage
+	err := scanScheduledMessage(DB.QueryRow(
+		"SELECT "+scheduledColumns+" FROM scheduled_messages WHERE id = $1 AND sender_id = $2",
+		id, senderID,
+	), &s)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// GetScheduledMessages lists a sender's pending scheduled messages, soonest first
+func GetScheduledMessages(senderID int64) ([]models.ScheduledMessage, error) {
+	rows, err := DB.Query(
+		"SELECT "+scheduledColumns+" FROM scheduled_messages WHERE sender_id = $1 ORDER BY send_at, id",
+		senderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var scheduled []models.ScheduledMessage
+	for rows.Next() {
+		var s models.ScheduledMessage
+		if err := scanScheduledMessage(rows, &s); err != nil {
+			return nil, err
+		}
+		scheduled = append(scheduled, s)
+	}
+	return scheduled, rows.Err()
+}
+
+// UpdateScheduledMessage changes the content and send time of a pending
+// scheduled message. It returns sql.ErrNoRows if it was already sent.
+func UpdateScheduledMessage(id, senderID int64, content, contentHTML string, sendAt time.Time) (*models.ScheduledMessage, error) {
+	var s models.ScheduledMessage
+	err := scanScheduledMessage(DB.QueryRow(
+		`UPDATE scheduled_messages SET content = $3, content_html = $4, send_at = $5, updated_at = NOW()
+		WHERE id = $1 AND sender_id = $2
+		RETURNING `+scheduledColumns,
+		id, senderID, content, contentHTML, sendAt,
+	), &s)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// DeleteScheduledMessage cancels a pending scheduled message. It reports
+// false if there was nothing to cancel.
+func DeleteScheduledMessage(id, senderID int64) (bool, error) {
+	result, err := DB.Exec("DELETE FROM scheduled_messages WHERE id = $1 AND sender_id = $2", id, senderID)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// SendDueScheduledMessage turns the oldest due scheduled message into a
+// real message and returns the scheduled ID along with it. Claiming and
+// inserting happen in one statement, so a scheduled message is sent exactly
+// once even across restarts or with several server instances. It returns
+// sql.ErrNoRows when nothing is due.
+func SendDueScheduledMessage() (int64, *models.Message, error) {
+	var scheduledID, messageID int64
+	err := DB.QueryRow(
+		`WITH due AS (
+			DELETE FROM scheduled_messages WHERE id = (
+				SELECT id FROM scheduled_messages WHERE send_at <= NOW()
+				ORDER BY send_at, id LIMIT 1 FOR UPDATE SKIP LOCKED
+			)
+			RETURNING *
+		), sent AS (
+			INSERT INTO messages (sender_id, receiver_id, content, type, format, content_html, expires_at, replied_to_message_id, max_views,
+				expire_after_read, media_path)
+			SELECT due.sender_id, due.receiver_id, due.content, due.type, due.format, due.content_html,
+				LEAST(
+					CASE WHEN due.expire_seconds IS NULL THEN NULL ELSE NOW() + due.expire_seconds * INTERVAL '1 second' END,
+					CASE WHEN NOT dt.after_read THEN NOW() + dt.ttl_seconds * INTERVAL '1 second' END
+				),
+				due.replied_to_message_id, due.max_views,
+				CASE WHEN dt.after_read THEN dt.ttl_seconds END,
+				CASE WHEN due.type = 'snap' THEN due.content END
+			FROM due
+			LEFT JOIN disappearing_timers dt
+				ON dt.user_a = LEAST(due.sender_id, due.receiver_id) AND dt.user_b = GREATEST(due.sender_id, due.receiver_id)
+			RETURNING id
+		)
+		SELECT due.id, sent.id FROM due, sent`,
+	).Scan(&scheduledID, &messageID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	msg, err := GetMessageByID(messageID)
+	if err != nil {
+		return 0, nil, err
+	}
+	return scheduledID, msg, nil
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"scuffedsnap/models"
+)
+
+const snapsSchema = `
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS max_views INTEGER DEFAULT 1;
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS view_count INTEGER DEFAULT 0;
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS opened_at TIMESTAMP;
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS purge_at TIMESTAMP;
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS purged_at TIMESTAMP;
+
+	-- Where a snap's media lives, kept after unsending blanks the content
+	-- so the janitor can still delete it
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS media_path TEXT;
+	UPDATE messages SET media_path = content
+	WHERE type = 'snap' AND media_path IS NULL AND purged_at IS NULL AND content <> '';
+
+	CREATE INDEX IF NOT EXISTS idx_messages_snap_purge ON messages(purge_at) WHERE type = 'snap' AND purged_at IS NULL;
+`
+
+// Snap queries
+
+// OpenSnap counts one view of a snap by its receiver and returns the
+// content. Once the last allowed view is used the snap is scheduled for
+// purging after grace, which gives the client time to load the media.
+// It returns sql.ErrNoRows when the snap cannot be opened (any more).
+func OpenSnap(messageID, receiverID int64, grace time.Duration) (*models.Message, error) {
+	var content string
+	err := DB.QueryRow(
+		`UPDATE messages SET
+			view_count = view_count + 1,
+			opened_at = COALESCE(opened_at, NOW()),
+			purge_at = CASE WHEN view_count + 1 >= max_views THEN NOW() + $3 * INTERVAL '1 second' ELSE purge_at END
+		WHERE id = $1 AND receiver_id = $2 AND type = 'snap'
+			AND view_count < max_views AND purged_at IS NULL AND deleted_at IS NULL
+			AND (expires_at IS NULL OR expires_at > NOW())
+		RETURNING content`,
+		messageID, receiverID, grace.Seconds(),
+	).Scan(&content)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := GetMessageByID(messageID)
+	if err != nil {
+		return nil, err
+	}
+	msg.Content = content
+	return msg, nil
+}
+
+// PurgedSnap is a snap whose content was removed by PurgeSnaps
+type PurgedSnap struct {
+	ID         int64
+	SenderID   int64
+	ReceiverID int64
+	MediaPath  string // Where the media was stored, to clean it up
+	Opened     bool
+	Deleted    bool // Unsent before it was purged
+}
+
+// PurgeSnaps wipes the content of snaps that were fully viewed, timed out
+// or unsent
+func PurgeSnaps() ([]PurgedSnap, error) {
+	rows, err := DB.Query(
+		`UPDATE messages m SET content = '', media_path = NULL, purged_at = NOW()
+		FROM messages old
+		WHERE m.id = old.id AND m.type = 'snap' AND m.purged_at IS NULL
+			AND (m.purge_at <= NOW() OR m.expires_at <= NOW())
+		RETURNING m.id, m.sender_id, m.receiver_id, old.media_path, m.view_count > 0, m.deleted_at IS NOT NULL`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snaps []PurgedSnap
+	for rows.Next() {
+		var s PurgedSnap
+		var mediaPath sql.NullString
+		if err := rows.Scan(&s.ID, &s.SenderID, &s.ReceiverID, &mediaPath, &s.Opened, &s.Deleted); err != nil {
+			return nil, err
+		}
+		s.MediaPath = mediaPath.String
+		snaps = append(snaps, s)
+	}
+	return snaps, rows.Err()
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"scuffedsnap/models"
+)
+
+const starsSchema = `
+	CREATE TABLE IF NOT EXISTS message_stars (
+		message_id BIGINT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+		user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		starred_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (message_id, user_id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_message_stars_user ON message_stars(user_id, starred_at DESC);
+`
+
+// Star queries
+
+// StarMessage bookmarks a message for one user. It reports false if the
+// message was already starred, or is not one the user can still see.
+func StarMessage(messageID, userID int64) (bool, error) {
+	result, err := DB.Exec(
+		`INSERT INTO message_stars (message_id, user_id)
+		SELECT m.id, $2 FROM messages m
+		WHERE m.id = $1 AND (m.sender_id = $2 OR m.receiver_id = $2)
+		  AND m.deleted_at IS NULL AND (m.expires_at IS NULL OR m.expires_at > NOW())
+		  AND NOT EXISTS (SELECT 1 FROM message_hidden h WHERE h.message_id = m.id AND h.user_id = $2)
+		ON CONFLICT DO NOTHING`,
+		messageID, userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// UnstarMessage removes a user's star. It reports false if the message was
+// not starred.
+func UnstarMessage(messageID, userID int64) (bool, error) {
+	result, err := DB.Exec(
+		"DELETE FROM message_stars WHERE message_id = $1 AND user_id = $2",
+		messageID, userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// GetStarredMessages retrieves the messages a user starred across all
+// conversations, most recently starred first
+func GetStarredMessages(userID int64, limit, offset int) ([]models.MessageWithSender, error) {
+	rows, err := DB.Query(
+		`SELECT `+messageColumns+`, u.username, u.avatar, `+replyPreviewColumns+`
+		FROM message_stars st
+		JOIN messages m ON st.message_id = m.id
+		JOIN users u ON m.sender_id = u.id
+		`+replyPreviewJoin+`
+		WHERE st.user_id = $1
+		  AND (m.sender_id = $1 OR m.receiver_id = $1)
+		  AND m.deleted_at IS NULL
+		  AND (m.expires_at IS NULL OR m.expires_at > NOW())
+		ORDER BY st.starred_at DESC, m.id DESC
+		LIMIT $2 OFFSET $3`,
+		userID, limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []models.MessageWithSender
+	for rows.Next() {
+		msg, err := scanMessageWithSender(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *msg)
+	}
+
+	if err := prepareMessages(messages, userID); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
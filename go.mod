@@ -12,6 +12,7 @@ require (
 	github.com/lib/pq v1.10.9
 	github.com/supabase-community/supabase-go v0.0.4
 	golang.org/x/crypto v0.31.0
+	golang.org/x/net v0.25.0
 )
 
 require (
@@ -22,5 +23,4 @@ require (
 	github.com/supabase-community/postgrest-go v0.0.11 // indirect
 	github.com/supabase-community/storage-go v0.7.0 // indirect
 	github.com/tomnomnom/linkheader v0.0.0-20180905144013-02ca5825eb80 // indirect
-	golang.org/x/net v0.25.0 // indirect
 )
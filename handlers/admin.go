@@ -2,7 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
+
+	"scuffedsnap/database"
+	"scuffedsnap/middleware"
 )
 
 type AdminStatsResponse struct {
@@ -12,6 +17,11 @@ type AdminStatsResponse struct {
 	PendingRequests int `json:"pending_requests"`
 }
 
+type disableUserRequest struct {
+	UserID   int64 `json:"user_id"`
+	Disabled bool  `json:"disabled"`
+}
+
 type UserManagementResponse struct {
 	ID        string `json:"id"`
 	Username  string `json:"username"`
@@ -49,3 +59,66 @@ func DeleteUserAccount(w http.ResponseWriter, r *http.Request) {
 		"message": "User deletion should be handled client-side via Supabase",
 	})
 }
+
+// DisableUser disables or re-enables a user account (admin only).
+// Disabling revokes every session and kicks the user's live WebSocket.
+func DisableUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	admin := middleware.GetUserFromContext(r)
+	if admin == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req disableUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.UserID == admin.ID {
+		http.Error(w, `{"error": "You cannot disable your own account"}`, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := database.GetUserByID(req.UserID); err != nil {
+		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
+		return
+	}
+
+	if err := SetUserDisabled(&admin.ID, req.UserID, req.Disabled, ""); err != nil {
+		http.Error(w, `{"error": "Failed to update user"}`, http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"disabled": req.Disabled,
+	})
+}
+
+// SetUserDisabled changes an account's disabled flag and records it in the
+// audit log with actorID, which is nil for the CLI. Disabling also revokes
+// sessions and kicks the live connections of this process.
+func SetUserDisabled(actorID *int64, userID int64, disabled bool, details string) error {
+	if err := database.DisableUser(userID, disabled); err != nil {
+		return err
+	}
+
+	action := "user.enable"
+	var revokeErr error
+	if disabled {
+		action = "user.disable"
+		revokeErr = database.DeleteAllUserSessions(userID)
+		DisconnectUser(userID, "Account disabled")
+	}
+
+	if err := database.CreateAuditLog(actorID, action, &userID, details); err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+	if revokeErr != nil {
+		return fmt.Errorf("user disabled but session revocation failed: %w", revokeErr)
+	}
+	return nil
+}
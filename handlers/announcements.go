@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"scuffedsnap/database"
+	"scuffedsnap/middleware"
+	"scuffedsnap/models"
+	"scuffedsnap/pkg/push"
+)
+
+type createAnnouncementRequest struct {
+	Severity  models.AnnouncementSeverity `json:"severity"`
+	Text      string                      `json:"text"`
+	ExpiresAt *time.Time                  `json:"expires_at"`
+	Push      bool                        `json:"push"` // Also send as a web push notification
+}
+
+// CreateAnnouncement broadcasts a system announcement to every user (admin only)
+func CreateAnnouncement(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	admin := middleware.GetUserFromContext(r)
+	if admin == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req createAnnouncementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	req.Text = strings.TrimSpace(req.Text)
+	if req.Text == "" || len(req.Text) > 2000 {
+		http.Error(w, `{"error": "Text must be 1-2000 characters"}`, http.StatusBadRequest)
+		return
+	}
+
+	switch req.Severity {
+	case "":
+		req.Severity = models.AnnouncementInfo
+	case models.AnnouncementInfo, models.AnnouncementWarning, models.AnnouncementCritical:
+	default:
+		http.Error(w, `{"error": "Invalid severity"}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		http.Error(w, `{"error": "Expiry must be in the future"}`, http.StatusBadRequest)
+		return
+	}
+
+	announcement, err := database.CreateAnnouncement(admin.ID, req.Severity, req.Text, req.ExpiresAt)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to create announcement"}`, http.StatusInternalServerError)
+		return
+	}
+
+	details := fmt.Sprintf("announcement %d (%s)", announcement.ID, announcement.Severity)
+	if err := database.CreateAuditLog(&admin.ID, "announcement.create", nil, details); err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+
+	// Deliver live and remember who already got it
+	delivered := BroadcastToAll(models.WebSocketMessage{
+		Type:    "announcement",
+		Payload: announcement,
+	})
+	for _, idStr := range delivered {
+		if userID, err := strconv.ParseInt(idStr, 10, 64); err == nil {
+			database.MarkAnnouncementDelivered(announcement.ID, userID)
+		}
+	}
+
+	if req.Push {
+		go push.SendToAll(push.Notification{
+			Title: "ScuffedSnap",
+			Body:  announcement.Text,
+			URL:   "/app",
+		})
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(announcement)
+}
+
+// GetAnnouncements returns every announcement that has not expired
+func GetAnnouncements(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	announcements, err := database.GetActiveAnnouncements()
+	if err != nil {
+		http.Error(w, `{"error": "Failed to get announcements"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if announcements == nil {
+		announcements = []models.Announcement{}
+	}
+
+	json.NewEncoder(w).Encode(announcements)
+}
+
+// deliverPendingAnnouncements sends announcements a user missed while
+// offline to a newly connected client. Only session-authenticated
+// connections qualify, since anyone can claim a user ID in the query string.
+func deliverPendingAnnouncements(client *Client) {
+	if database.DB == nil || !client.Authenticated {
+		return
+	}
+
+	id, err := strconv.ParseInt(client.UserID, 10, 64)
+	if err != nil {
+		return
+	}
+
+	announcements, err := database.ClaimUndeliveredAnnouncements(id)
+	if err != nil {
+		log.Printf("Failed to get announcements for user %d: %v", id, err)
+		return
+	}
+
+	for _, a := range announcements {
+		broadcast(BroadcastPayload{UserID: client.UserID, Client: client}, models.WebSocketMessage{
+			Type:    "announcement",
+			Payload: a,
+		})
+	}
+}
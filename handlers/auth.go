@@ -133,6 +133,12 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Disabled accounts cannot sign in
+	if user.IsDisabled {
+		http.Error(w, `{"error": "Account disabled"}`, http.StatusForbidden)
+		return
+	}
+
 	// Create session
 	sessionID := generateSessionID()
 	expiresAt := time.Now().Add(7 * 24 * time.Hour)
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"scuffedsnap/database"
+	"scuffedsnap/middleware"
+	"scuffedsnap/models"
+)
+
+// lastBadges remembers the counts last sent to each user so unchanged
+// badges are not sent again
+var (
+	lastBadges   = make(map[int64]models.BadgeCounts)
+	lastBadgesMu sync.Mutex
+)
+
+// GetBadge returns the current user's unread and pending counts
+func GetBadge(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	badge, err := database.GetBadgeCounts(user.ID)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to get badge"}`, http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(badge)
+}
+
+// sendBadge recounts a user's badge and sends it as a badge event if it
+// changed since the last one
+func sendBadge(userID int64) {
+	badge, err := database.GetBadgeCounts(userID)
+	if err != nil {
+		log.Printf("Failed to count badge for user %d: %v", userID, err)
+		return
+	}
+
+	lastBadgesMu.Lock()
+	last, ok := lastBadges[userID]
+	unchanged := ok && last == *badge
+	lastBadges[userID] = *badge
+	lastBadgesMu.Unlock()
+	if unchanged {
+		return
+	}
+
+	BroadcastMessage(userID, models.WebSocketMessage{
+		Type:    "badge",
+		Payload: badge,
+	})
+}
+
+// forgetBadge drops the remembered counts of a user with no connections
+// left, so the map does not grow with every user who ever connected. The
+// caller holds the hub lock; sendBadge never waits on the hub while holding
+// lastBadgesMu, so the order is safe
+func forgetBadge(userID string) {
+	id, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
+		return
+	}
+	lastBadgesMu.Lock()
+	delete(lastBadges, id)
+	lastBadgesMu.Unlock()
+}
+
+// badgeTotal is the count shown on a user's web push badge, or nil if it
+// could not be counted and the badge should be left alone
+func badgeTotal(userID int64) *int {
+	badge, err := database.GetBadgeCounts(userID)
+	if err != nil {
+		log.Printf("Failed to count badge for user %d: %v", userID, err)
+		return nil
+	}
+	return &badge.Total
+}
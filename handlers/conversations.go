@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"scuffedsnap/database"
+	"scuffedsnap/middleware"
+	"scuffedsnap/models"
+)
+
+// maxPinnedConversations is how many conversations a user may pin to the
+// top of their list
+const maxPinnedConversations = 5
+
+type conversationSettingsRequest struct {
+	Muted        *bool      `json:"muted"`
+	MutedUntil   *time.Time `json:"muted_until"` // Implies muted; omit to mute indefinitely
+	Archived     *bool      `json:"archived"`
+	KeepArchived *bool      `json:"keep_archived"`
+	Pinned       *bool      `json:"pinned"`
+}
+
+// UpdateConversation changes the current user's mute, archive and pin
+// settings for the conversation with {userId}
+func UpdateConversation(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	otherUserID, err := strconv.ParseInt(vars["userId"], 10, 64)
+	if err != nil {
+		http.Error(w, `{"error": "Invalid user ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	var req conversationSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := database.GetUserByID(otherUserID); err != nil {
+		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
+		return
+	}
+
+	settings, err := database.GetConversationSettings(user.ID, otherUserID)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to get conversation settings"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if req.MutedUntil != nil {
+		if req.Muted != nil && !*req.Muted {
+			http.Error(w, `{"error": "muted_until needs muted"}`, http.StatusBadRequest)
+			return
+		}
+		if !req.MutedUntil.After(time.Now()) {
+			http.Error(w, `{"error": "muted_until must be in the future"}`, http.StatusBadRequest)
+			return
+		}
+		settings.Muted = true
+		settings.MutedUntil = req.MutedUntil
+	} else if req.Muted != nil {
+		settings.Muted = *req.Muted
+		settings.MutedUntil = nil
+	}
+
+	if req.KeepArchived != nil {
+		settings.KeepArchived = *req.KeepArchived
+	}
+
+	// Archived conversations leave the pinned section and pinning one
+	// brings it back out of the archive
+	if req.Archived != nil {
+		settings.Archived = *req.Archived
+		if settings.Archived {
+			settings.PinnedAt = nil
+		}
+	}
+	if req.Pinned != nil {
+		if !*req.Pinned {
+			settings.PinnedAt = nil
+		} else if settings.PinnedAt == nil {
+			now := time.Now()
+			settings.PinnedAt = &now
+			settings.Archived = false
+		}
+	}
+
+	// The pin limit is enforced while saving
+	saved, err := database.SaveConversationSettings(user.ID, otherUserID, settings, maxPinnedConversations)
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "Too many pinned conversations"}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error": "Failed to update conversation settings"}`, http.StatusInternalServerError)
+		return
+	}
+
+	BroadcastToOtherDevices(user.ID, r.Header.Get("X-Device-ID"), conversationUpdatedEvent(otherUserID, saved))
+
+	json.NewEncoder(w).Encode(saved)
+}
+
+func conversationUpdatedEvent(otherUserID int64, settings *models.ConversationSettings) models.WebSocketMessage {
+	return models.WebSocketMessage{
+		Type: "conversation_updated",
+		Payload: map[string]interface{}{
+			"user_id":  otherUserID,
+			"settings": settings,
+		},
+	}
+}
+
+// unarchiveConversation brings a conversation with a new message back out
+// of the archive and tells the affected users' clients
+func unarchiveConversation(senderID, receiverID int64) {
+	userIDs, err := database.UnarchiveConversation(senderID, receiverID)
+	if err != nil {
+		log.Printf("Failed to unarchive conversation %d-%d: %v", senderID, receiverID, err)
+		return
+	}
+
+	for _, userID := range userIDs {
+		otherUserID := senderID
+		if userID == senderID {
+			otherUserID = receiverID
+		}
+		settings, err := database.GetConversationSettings(userID, otherUserID)
+		if err != nil {
+			continue
+		}
+		BroadcastMessage(userID, conversationUpdatedEvent(otherUserID, settings))
+	}
+}
+
+// conversationMuted reports whether userID muted their conversation with
+// otherUserID, in which case they get no push notifications from it
+func conversationMuted(userID, otherUserID int64) bool {
+	muted, err := database.IsConversationMuted(userID, otherUserID)
+	if err != nil {
+		log.Printf("Failed to check mute for %d-%d: %v", userID, otherUserID, err)
+		return false
+	}
+	return muted
+}
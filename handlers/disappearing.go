@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"scuffedsnap/database"
+	"scuffedsnap/middleware"
+	"scuffedsnap/models"
+	"scuffedsnap/pkg/push"
+)
+
+type disappearingTimerRequest struct {
+	Timer string `json:"timer"` // "off", "30s_after_read", "1h", "24h" or "7d"
+}
+
+// GetDisappearingTimer returns the disappearing message timer of the
+// conversation with {userId}
+func GetDisappearingTimer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	otherUserID, err := strconv.ParseInt(vars["userId"], 10, 64)
+	if err != nil {
+		http.Error(w, `{"error": "Invalid user ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	timer, err := database.GetDisappearingTimer(user.ID, otherUserID)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to get disappearing timer"}`, http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(timer)
+}
+
+// disappearingPartner loads the other participant of the conversation with
+// {userId}. Timers can only be set with friends and people user has already
+// exchanged messages with.
+func disappearingPartner(r *http.Request, user *models.User) (*models.User, error) {
+	otherUserID, err := strconv.ParseInt(mux.Vars(r)["userId"], 10, 64)
+	if err != nil {
+		return nil, &requestError{http.StatusBadRequest, "Invalid user ID"}
+	}
+
+	other, err := database.GetUserByID(otherUserID)
+	if err != nil {
+		return nil, &requestError{http.StatusNotFound, "User not found"}
+	}
+
+	connected, err := database.AreConnected(user.ID, other.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !connected && user.ID != other.ID {
+		return nil, &requestError{http.StatusForbidden, "Disappearing messages can only be set in an existing conversation"}
+	}
+	return other, nil
+}
+
+// SetDisappearingTimer asks for a disappearing message timer in the
+// conversation with {userId}. Because a timer deletes both participants'
+// messages, it is only proposed and applies once the other participant
+// accepts it, or asks for the same timer themselves. Turning it off makes
+// nothing expire sooner and applies right away. Both participants see every
+// change as a system message, and only messages sent afterwards are
+// affected.
+func SetDisappearingTimer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	other, err := disappearingPartner(r, user)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	var req disappearingTimerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	timer, ok := models.NewDisappearingTimer(req.Timer)
+	if !ok {
+		http.Error(w, `{"error": "Invalid timer"}`, http.StatusBadRequest)
+		return
+	}
+
+	current, err := database.GetDisappearingTimer(user.ID, other.ID)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to get disappearing timer"}`, http.StatusInternalServerError)
+		return
+	}
+	if current.Timer == timer.Timer {
+		json.NewEncoder(w).Encode(current)
+		return
+	}
+
+	if pending := current.Pending; pending != nil && pending.ProposedBy == other.ID && pending.Timer == timer.Timer {
+		acceptDisappearingTimer(w, user, other, timer)
+		return
+	}
+
+	if timer.Timer == models.DisappearingOff || user.ID == other.ID {
+		notice := fmt.Sprintf("%s set disappearing messages to %s", user.Username, timer.Label())
+		if timer.Timer == models.DisappearingOff {
+			notice = fmt.Sprintf("%s turned off disappearing messages", user.Username)
+		}
+
+		message, err := database.SetDisappearingTimer(user.ID, other.ID, timer, notice)
+		if err != nil {
+			http.Error(w, `{"error": "Failed to set disappearing timer"}`, http.StatusInternalServerError)
+			return
+		}
+		publishDisappearingTimer(w, http.StatusOK, "disappearing_timer_updated", user, other, message)
+		return
+	}
+
+	notice := fmt.Sprintf("%s wants to set disappearing messages to %s", user.Username, timer.Label())
+	message, err := database.ProposeDisappearingTimer(user.ID, other.ID, timer, notice)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to propose disappearing timer"}`, http.StatusInternalServerError)
+		return
+	}
+	publishDisappearingTimer(w, http.StatusAccepted, "disappearing_timer_proposed", user, other, message)
+
+	// The timer waits on the other participant, so make sure they hear of it
+	if !conversationMuted(other.ID, user.ID) {
+		go push.SendToUser(strconv.FormatInt(other.ID, 10), push.Notification{
+			Title: fmt.Sprintf("%s wants disappearing messages", user.Username),
+			Body:  fmt.Sprintf("Messages would disappear after %s", timer.Label()),
+			URL:   "/app",
+			Badge: badgeTotal(other.ID),
+		})
+	}
+}
+
+// AcceptDisappearingTimer applies the timer the participant {userId}
+// proposed. The request names the timer being accepted, so a proposal that
+// changed in the meantime is not accepted by accident.
+func AcceptDisappearingTimer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	other, err := disappearingPartner(r, user)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	var req disappearingTimerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	timer, ok := models.NewDisappearingTimer(req.Timer)
+	if !ok || timer.Timer == models.DisappearingOff {
+		http.Error(w, `{"error": "Invalid timer"}`, http.StatusBadRequest)
+		return
+	}
+
+	acceptDisappearingTimer(w, user, other, timer)
+}
+
+func acceptDisappearingTimer(w http.ResponseWriter, user, other *models.User, timer *models.DisappearingTimer) {
+	notice := fmt.Sprintf("%s accepted disappearing messages after %s", user.Username, timer.Label())
+	message, err := database.AcceptDisappearingTimer(user.ID, other.ID, timer, notice)
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "No matching proposal to accept"}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error": "Failed to set disappearing timer"}`, http.StatusInternalServerError)
+		return
+	}
+	publishDisappearingTimer(w, http.StatusOK, "disappearing_timer_updated", user, other, message)
+}
+
+// DeclineDisappearingTimer drops the pending timer proposal of the
+// conversation with {userId}. The proposer withdraws it this way and the
+// other participant declines it.
+func DeclineDisappearingTimer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	other, err := disappearingPartner(r, user)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	current, err := database.GetDisappearingTimer(user.ID, other.ID)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to get disappearing timer"}`, http.StatusInternalServerError)
+		return
+	}
+	if current.Pending == nil {
+		http.Error(w, `{"error": "No pending proposal"}`, http.StatusNotFound)
+		return
+	}
+
+	notice := fmt.Sprintf("%s declined disappearing messages after %s", user.Username, current.Pending.Label())
+	if current.Pending.ProposedBy == user.ID {
+		notice = fmt.Sprintf("%s withdrew the request for disappearing messages", user.Username)
+	}
+
+	message, err := database.DeclineDisappearingTimer(user.ID, other.ID, notice)
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "No pending proposal"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error": "Failed to decline disappearing timer"}`, http.StatusInternalServerError)
+		return
+	}
+	publishDisappearingTimer(w, http.StatusOK, "disappearing_timer_updated", user, other, message)
+}
+
+// publishDisappearingTimer sends the system message about a timer change to
+// both participants as eventType and responds with the conversation's timer
+func publishDisappearingTimer(w http.ResponseWriter, status int, eventType string, user, other *models.User, message *models.Message) {
+	updated, err := database.GetDisappearingTimer(user.ID, other.ID)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to get disappearing timer"}`, http.StatusInternalServerError)
+		return
+	}
+
+	outgoing := publishMessage(user, other, message)
+
+	// Each side is told about the conversation from their own point of view
+	for _, pair := range [][2]int64{{user.ID, other.ID}, {other.ID, user.ID}} {
+		BroadcastMessage(pair[0], models.WebSocketMessage{
+			Type: eventType,
+			Payload: map[string]interface{}{
+				"user_id": pair[1],
+				"timer":   updated,
+				"message": outgoing,
+			},
+		})
+		if user.ID == other.ID {
+			break
+		}
+	}
+
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(updated)
+}
+
+// RunExpiryJanitor periodically deletes disappearing messages that have
+// expired, for both participants
+func RunExpiryJanitor() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		deleteExpiredMessages()
+	}
+}
+
+func deleteExpiredMessages() {
+	expired, err := database.DeleteExpiredMessages()
+	if err != nil {
+		log.Printf("Failed to delete expired messages: %v", err)
+		return
+	}
+
+	// Receivers may still count messages they never read in their badge
+	unread := make(map[int64]bool)
+	for _, m := range expired {
+		if m.Unread {
+			unread[m.ReceiverID] = true
+		}
+	}
+	for userID := range unread {
+		sendBadge(userID)
+	}
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"scuffedsnap/database"
+	"scuffedsnap/middleware"
+	"scuffedsnap/models"
+)
+
+// maxDraftLength bounds how much unsent text is stored per conversation
+const maxDraftLength = 10000
+
+// maxDraftClockSkew is how far ahead of the server a device clock may be
+// before its timestamps are replaced with the server time
+const maxDraftClockSkew = time.Minute
+
+type saveDraftRequest struct {
+	Content   string     `json:"content"`
+	UpdatedAt *time.Time `json:"updated_at"` // When the user typed it; defaults to now
+}
+
+// GetDrafts returns the current user's drafts in every conversation
+func GetDrafts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	drafts, err := database.GetDrafts(user.ID)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to get drafts"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if drafts == nil {
+		drafts = []models.Draft{}
+	}
+
+	json.NewEncoder(w).Encode(drafts)
+}
+
+// GetDraft returns the current user's draft for the conversation with {userId}
+func GetDraft(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	otherUserID, err := strconv.ParseInt(vars["userId"], 10, 64)
+	if err != nil {
+		http.Error(w, `{"error": "Invalid user ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	draft, err := database.GetDraft(user.ID, otherUserID)
+	if err == sql.ErrNoRows || (err == nil && draft.Content == "") {
+		http.Error(w, `{"error": "Draft not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error": "Failed to get draft"}`, http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(draft)
+}
+
+// SaveDraft stores the draft for the conversation with {userId}. An older
+// save than the stored one is ignored and the stored draft is returned.
+func SaveDraft(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req saveDraftRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Content) > maxDraftLength {
+		http.Error(w, `{"error": "Draft is too long"}`, http.StatusBadRequest)
+		return
+	}
+
+	updateDraft(w, r, user, req.Content, req.UpdatedAt)
+}
+
+// ClearDraft empties the draft for the conversation with {userId}, e.g.
+// after the message was sent. ?updated_at= works as for SaveDraft.
+func ClearDraft(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var updatedAt *time.Time
+	if v := r.URL.Query().Get("updated_at"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			http.Error(w, `{"error": "Invalid updated_at"}`, http.StatusBadRequest)
+			return
+		}
+		updatedAt = &t
+	}
+
+	updateDraft(w, r, user, "", updatedAt)
+}
+
+// updateDraft saves a draft and tells the user's other devices about it.
+// Devices identify themselves with the X-Device-ID header so they do not
+// get their own change echoed back.
+func updateDraft(w http.ResponseWriter, r *http.Request, user *models.User, content string, updatedAt *time.Time) {
+	vars := mux.Vars(r)
+	otherUserID, err := strconv.ParseInt(vars["userId"], 10, 64)
+	if err != nil {
+		http.Error(w, `{"error": "Invalid user ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := database.GetUserByID(otherUserID); err != nil {
+		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
+		return
+	}
+
+	now := time.Now()
+	if updatedAt == nil || updatedAt.After(now.Add(maxDraftClockSkew)) {
+		updatedAt = &now
+	}
+
+	draft, saved, err := database.SaveDraft(user.ID, otherUserID, content, *updatedAt)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to save draft"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if saved {
+		BroadcastToOtherDevices(user.ID, r.Header.Get("X-Device-ID"), models.WebSocketMessage{
+			Type:    "draft_updated",
+			Payload: draft,
+		})
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"saved": saved,
+		"draft": draft,
+	})
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"scuffedsnap/database"
+	"scuffedsnap/middleware"
+	"scuffedsnap/models"
+	"scuffedsnap/pkg/filter"
+)
+
+// maxForwardTargets is how many conversations a message can be forwarded
+// to in one request
+const maxForwardTargets = 20
+
+type forwardMessageRequest struct {
+	ReceiverIDs []int64 `json:"receiver_ids"`
+}
+
+// ForwardMessage copies a message into one or more other conversations.
+// Media is forwarded by reference, so nothing is uploaded again.
+func ForwardMessage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	messageID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, `{"error": "Invalid message ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	var req forwardMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	if len(req.ReceiverIDs) == 0 || len(req.ReceiverIDs) > maxForwardTargets {
+		http.Error(w, `{"error": "receiver_ids must list 1-20 users"}`, http.StatusBadRequest)
+		return
+	}
+
+	original, err := database.GetMessageByID(messageID)
+	if err != nil || (original.SenderID != user.ID && original.ReceiverID != user.ID) || original.DeletedAt != nil {
+		http.Error(w, `{"error": "Message not found"}`, http.StatusNotFound)
+		return
+	}
+
+	// View-once and disappearing messages must not outlive their rules
+	// in another chat. Polls belong to the chat they were asked in.
+	if original.Type == models.MessageTypeSnap || original.Type == models.MessageTypePoll ||
+		original.Type == models.MessageTypeSystem || original.ExpiresAt != nil || original.ExpireAfterRead != nil {
+		http.Error(w, `{"error": "This message cannot be forwarded"}`, http.StatusForbidden)
+		return
+	}
+
+	// Forwards of forwards keep pointing at the first message
+	forwardedFrom := &models.ForwardInfo{
+		MessageID:  &original.ID,
+		SenderID:   original.SenderID,
+		ReceiverID: original.ReceiverID,
+	}
+	if original.ForwardedFrom != nil {
+		forwardedFrom = original.ForwardedFrom
+	}
+
+	// The forwarder is the one sending this text now, and every target
+	// conversation has its own filter settings. All of them are checked
+	// before anything is sent.
+	receivers := make([]*models.User, 0, len(req.ReceiverIDs))
+	results := make([]filter.Result, 0, len(req.ReceiverIDs))
+	seen := make(map[int64]bool)
+	for _, id := range req.ReceiverIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		receiver, err := database.GetUserByID(id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error": "Recipient %d not found"}`, id), http.StatusNotFound)
+			return
+		}
+
+		filtered := filter.Result{Content: original.Content}
+		if original.Type == "text" {
+			filtered = filter.Check(original.Content, user.ID, receiver.ID)
+			if filtered.Rejected {
+				http.Error(w, `{"error": "Message blocked by content filter"}`, http.StatusUnprocessableEntity)
+				return
+			}
+		}
+
+		receivers = append(receivers, receiver)
+		results = append(results, filtered)
+	}
+
+	forwarded := []*models.Message{}
+	for i, receiver := range receivers {
+		filtered := results[i]
+		message, err := database.CreateMessage(database.NewMessage{
+			SenderID:      user.ID,
+			ReceiverID:    receiver.ID,
+			Content:       filtered.Content,
+			Type:          original.Type,
+			Format:        original.Format,
+			ContentHTML:   renderContent(original.Format, filtered.Content),
+			ForwardedFrom: forwardedFrom,
+		})
+		if err != nil {
+			http.Error(w, `{"error": "Failed to forward message"}`, http.StatusInternalServerError)
+			return
+		}
+
+		if filtered.Flagged {
+			auditFlaggedMessage(user.ID, fmt.Sprintf("message %d", message.ID), filtered)
+		}
+
+		publishMessage(user, receiver, message)
+		forwarded = append(forwarded, message)
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(forwarded)
+}
@@ -121,6 +121,7 @@ func AddFriend(w http.ResponseWriter, r *http.Request) {
 			"from": user.ToResponse(),
 		},
 	})
+	sendBadge(friend.ID)
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
@@ -149,6 +150,7 @@ func AcceptFriend(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, `{"error": "Failed to accept friend request"}`, http.StatusInternalServerError)
 		return
 	}
+	sendBadge(user.ID)
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
@@ -178,6 +180,10 @@ func RemoveFriend(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Removing also declines or withdraws a pending request
+	sendBadge(user.ID)
+	sendBadge(friendID)
+
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
 		"message": "Friend removed",
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"sync"
+	"time"
+
+	"scuffedsnap/database"
+	"scuffedsnap/models"
+	"scuffedsnap/pkg/linkpreview"
+)
+
+// linkPreviewMaxAge is how long a fetched preview is reused for other
+// messages linking to the same URL
+const linkPreviewMaxAge = 24 * time.Hour
+
+// linkPreviewSlots limits how many pages are fetched at once
+var linkPreviewSlots = make(chan struct{}, 8)
+
+// linkPreviewsInFlight dedupes concurrent fetches of the same URL
+var linkPreviewsInFlight sync.Map
+
+// queueLinkPreview generates a preview for the first link in a text
+// message in the background
+func queueLinkPreview(message *models.Message) {
+	if message.Type != "text" {
+		return
+	}
+	url := linkpreview.FindURL(message.Content)
+	if url == "" {
+		return
+	}
+	go attachLinkPreview(message.ID, url)
+}
+
+// attachLinkPreview stores the preview of url with the message and sends
+// the updated message to both participants
+func attachLinkPreview(messageID int64, url string) {
+	preview, err := getLinkPreview(url)
+	if err != nil {
+		log.Printf("Link preview for %s failed: %v", url, err)
+		return
+	}
+	if preview == nil {
+		return
+	}
+
+	attached, err := database.SetMessageLinkPreview(messageID, url, preview)
+	if err != nil {
+		log.Printf("Failed to save link preview for message %d: %v", messageID, err)
+		return
+	}
+	if !attached {
+		return
+	}
+
+	message, err := database.GetMessageByID(messageID)
+	if err != nil || message.DeletedAt != nil {
+		return
+	}
+
+	event := models.WebSocketMessage{
+		Type:    "message_updated",
+		Payload: message,
+	}
+	if message.ReceiverID != message.SenderID {
+		BroadcastMessage(message.ReceiverID, event)
+	}
+
+	// The event is encoded when sent, so the sender's copy can be redacted now
+	database.RedactReadReceipt(message, message.SenderID)
+	BroadcastMessage(message.SenderID, event)
+}
+
+// getLinkPreview returns the preview of url from the cache or fetches it.
+// A nil preview means the page has none.
+func getLinkPreview(url string) (*models.LinkPreview, error) {
+	cached, err := database.GetCachedLinkPreview(url, linkPreviewMaxAge)
+	if err == nil {
+		return cached, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	if _, busy := linkPreviewsInFlight.LoadOrStore(url, true); busy {
+		// Another message is fetching it; wait for the cache instead of
+		// hitting the site twice
+		time.Sleep(10 * time.Second)
+		cached, err := database.GetCachedLinkPreview(url, linkPreviewMaxAge)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return cached, err
+	}
+	defer linkPreviewsInFlight.Delete(url)
+
+	linkPreviewSlots <- struct{}{}
+	fetched, fetchErr := linkpreview.Fetch(url)
+	<-linkPreviewSlots
+
+	var preview *models.LinkPreview
+	if fetchErr == nil {
+		preview = &models.LinkPreview{
+			URL:         fetched.URL,
+			Title:       fetched.Title,
+			Description: fetched.Description,
+			ImageURL:    fetched.ImageURL,
+			SiteName:    fetched.SiteName,
+		}
+	}
+
+	// Failures are cached too so a dead link is not retried for every message
+	if err := database.CacheLinkPreview(url, preview); err != nil {
+		log.Printf("Failed to cache link preview for %s: %v", url, err)
+	}
+	return preview, fetchErr
+}
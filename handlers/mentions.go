@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"scuffedsnap/database"
+	"scuffedsnap/middleware"
+	"scuffedsnap/models"
+	"scuffedsnap/pkg/push"
+)
+
+// mentionPattern matches @username not preceded by a word character, so
+// email addresses are not treated as mentions
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\w.-]{3,20})`)
+
+// resolveMentions returns the IDs of the participants mentioned in content.
+// Only users who can see the conversation can be mentioned.
+func resolveMentions(content string, participants []*models.User) []int64 {
+	var ids []int64
+	seen := make(map[int64]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		name := strings.TrimRight(match[1], ".-")
+		for _, p := range participants {
+			if !seen[p.ID] && strings.EqualFold(p.Username, name) {
+				ids = append(ids, p.ID)
+				seen[p.ID] = true
+			}
+		}
+	}
+	return ids
+}
+
+// notifyMentions sends the mention hub event and a push notification to each
+// mentioned user
+func notifyMentions(message *models.MessageWithSender, userIDs []int64) {
+	body := messagePushBody(&message.Message)
+
+	for _, userID := range userIDs {
+		BroadcastMessage(userID, models.WebSocketMessage{
+			Type:    "mention",
+			Payload: message,
+		})
+
+		if conversationMuted(userID, message.SenderID) {
+			continue
+		}
+
+		go push.SendToUser(strconv.FormatInt(userID, 10), push.Notification{
+			Title: fmt.Sprintf("%s mentioned you", message.SenderUsername),
+			Body:  body,
+			URL:   "/app",
+			Badge: badgeTotal(userID),
+		})
+	}
+}
+
+// GetMentions returns messages that mention the current user
+func GetMentions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	limit := 50
+	offset := 0
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 100 {
+			limit = parsed
+		}
+	}
+	if o := r.URL.Query().Get("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+
+	messages, err := database.GetMentionsForUser(user.ID, limit, offset)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to get mentions"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if messages == nil {
+		messages = []models.MessageWithSender{}
+	}
+
+	json.NewEncoder(w).Encode(messages)
+}
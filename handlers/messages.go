@@ -1,8 +1,13 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"os"
 	"strconv"
 	"time"
 
@@ -11,13 +16,70 @@ import (
 	"scuffedsnap/database"
 	"scuffedsnap/middleware"
 	"scuffedsnap/models"
+	"scuffedsnap/pkg/filter"
+	"scuffedsnap/pkg/linkpreview"
+	"scuffedsnap/pkg/markdown"
 )
 
 type sendMessageRequest struct {
 	ReceiverID int64  `json:"receiver_id"`
 	Content    string `json:"content"`
 	Type       string `json:"type"`
-	Disappear  bool   `json:"disappear"` // If true, message expires after being read
+	Format     string `json:"format"` // "plain" (default) or "markdown", text messages only
+
+	// Kept for older clients: the sender alone makes this one message expire
+	// 24 hours after sending. The conversation's disappearing timer still
+	// applies and whichever expires first wins.
+	Disappear bool `json:"disappear"`
+
+	RepliedToMessageID *int64 `json:"replied_to_message_id"`
+	Replays            int    `json:"replays"` // Snaps only: extra views allowed after the first
+
+	SendAt *time.Time `json:"send_at"` // Schedule the message instead of sending it now
+
+	Poll *pollRequest `json:"poll"` // Required for polls
+
+	// Optional client-generated ID; retries with the same ID return the
+	// original message, or the pending scheduled message for scheduled
+	// sends. The Idempotency-Key header works too.
+	ClientMsgID string `json:"client_msg_id"`
+}
+
+type markReadRequest struct {
+	UpToMessageID int64 `json:"up_to_message_id"` // 0 marks everything read
+}
+
+type editMessageRequest struct {
+	Content string `json:"content"`
+}
+
+// defaultEditWindow is how long after sending a message may still be edited
+// unless MESSAGE_EDIT_WINDOW overrides it (e.g. "30m", "0" to disable edits)
+const defaultEditWindow = 15 * time.Minute
+
+func messageEditWindow() time.Duration {
+	if v := os.Getenv("MESSAGE_EDIT_WINDOW"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+		log.Printf("Invalid MESSAGE_EDIT_WINDOW %q, using default", v)
+	}
+	return defaultEditWindow
+}
+
+// idempotencyWindow is how long a client message ID deduplicates retries
+const idempotencyWindow = 24 * time.Hour
+
+// maxClientMsgIDLength bounds client message IDs; a UUID needs 36
+const maxClientMsgIDLength = 64
+
+// renderContent returns the sanitized HTML for content in the given format,
+// or "" for plain text
+func renderContent(format, content string) string {
+	if format != models.MessageFormatMarkdown {
+		return ""
+	}
+	return markdown.Render(content)
 }
 
 // GetConversations returns all conversations for the current user
@@ -30,7 +92,10 @@ func GetConversations(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	conversations, err := database.GetConversations(user.ID)
+	// Archived conversations are listed separately with ?archived=true
+	archived := r.URL.Query().Get("archived") == "true"
+
+	conversations, err := database.GetConversations(user.ID, archived)
 	if err != nil {
 		http.Error(w, `{"error": "Failed to get conversations"}`, http.StatusInternalServerError)
 		return
@@ -79,23 +144,33 @@ func GetMessages(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	messages, err := database.GetMessagesBetweenUsers(user.ID, otherUserID, limit, offset)
+	messages, err := fetchHistory(user, otherUserID, limit, offset)
 	if err != nil {
 		http.Error(w, `{"error": "Failed to get messages"}`, http.StatusInternalServerError)
 		return
 	}
 
+	json.NewEncoder(w).Encode(messages)
+}
+
+// fetchHistory returns a page of the conversation with otherUserID and
+// marks what the other user sent as read
+func fetchHistory(user *models.User, otherUserID int64, limit, offset int) ([]models.MessageWithSender, error) {
+	messages, err := database.GetMessagesBetweenUsers(user.ID, otherUserID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
 	// Mark messages as read
-	database.MarkMessagesAsRead(otherUserID, user.ID)
+	markRead(user, otherUserID, 0)
 
 	if messages == nil {
 		messages = []models.MessageWithSender{}
 	}
-
-	json.NewEncoder(w).Encode(messages)
+	return messages, nil
 }
 
-// SendMessage creates a new message
+// SendMessage creates a new message, or schedules it when send_at is given
 func SendMessage(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -111,49 +186,287 @@ func SendMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Content == "" {
-		http.Error(w, `{"error": "Message content is required"}`, http.StatusBadRequest)
+	if req.ClientMsgID == "" {
+		req.ClientMsgID = r.Header.Get("Idempotency-Key")
+	}
+
+	message, scheduled, err := sendMessage(user, &req)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	if scheduled != nil {
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(scheduled)
 		return
 	}
 
+	json.NewEncoder(w).Encode(message)
+}
+
+// requestError is a request failure with the status and message to report
+// to the client
+type requestError struct {
+	Status  int
+	Message string
+}
+
+func (e *requestError) Error() string {
+	return e.Message
+}
+
+// writeRequestError writes err as a JSON error response
+func writeRequestError(w http.ResponseWriter, err error) {
+	status, message := http.StatusInternalServerError, "Internal server error"
+	if re, ok := err.(*requestError); ok {
+		status, message = re.Status, re.Message
+	}
+	body, _ := json.Marshal(map[string]string{"error": message})
+	http.Error(w, string(body), status)
+}
+
+// sendMessage validates, stores and publishes a message from user. It is
+// shared by the HTTP API and the WebSocket protocol. When req.SendAt is set
+// the message is scheduled instead and only scheduled is returned.
+// Validation failures are returned as *requestError.
+func sendMessage(user *models.User, req *sendMessageRequest) (*models.Message, *models.ScheduledMessage, error) {
+	if len(req.ClientMsgID) > maxClientMsgIDLength {
+		return nil, nil, &requestError{http.StatusBadRequest, "client_msg_id is too long"}
+	}
+
+	// A retry of a send that already went through gets the original back
+	if req.ClientMsgID != "" && req.SendAt != nil {
+		existing, err := database.GetScheduledMessageByClientMsgID(user.ID, req.ClientMsgID, idempotencyWindow)
+		if err == nil {
+			return nil, existing, nil
+		}
+		if err != sql.ErrNoRows {
+			return nil, nil, &requestError{http.StatusInternalServerError, "Failed to schedule message"}
+		}
+	} else if req.ClientMsgID != "" {
+		existing, err := originalMessage(user, req.ClientMsgID)
+		if err == nil {
+			return existing, nil, nil
+		}
+		if err != sql.ErrNoRows {
+			return nil, nil, &requestError{http.StatusInternalServerError, "Failed to send message"}
+		}
+	}
+
+	if req.Content == "" {
+		return nil, nil, &requestError{http.StatusBadRequest, "Message content is required"}
+	}
+
 	if req.Type == "" {
 		req.Type = "text"
 	}
+	if req.Type == models.MessageTypeSystem {
+		return nil, nil, &requestError{http.StatusBadRequest, "Invalid message type"}
+	}
+
+	switch req.Format {
+	case "":
+		req.Format = models.MessageFormatPlain
+	case models.MessageFormatPlain:
+	case models.MessageFormatMarkdown:
+		if req.Type != "text" {
+			return nil, nil, &requestError{http.StatusBadRequest, "Only text messages can use markdown"}
+		}
+	default:
+		return nil, nil, &requestError{http.StatusBadRequest, "Invalid format"}
+	}
 
 	// Check if receiver exists
 	receiver, err := database.GetUserByID(req.ReceiverID)
 	if err != nil {
-		http.Error(w, `{"error": "Recipient not found"}`, http.StatusNotFound)
-		return
+		return nil, nil, &requestError{http.StatusNotFound, "Recipient not found"}
 	}
 
-	// Set expiration for disappearing messages (24 hours if not read)
-	var expiresAt *time.Time
+	// Replies must point at a live message in this same conversation
+	if req.RepliedToMessageID != nil {
+		parent, err := database.GetMessageByID(*req.RepliedToMessageID)
+		if err != nil || !isConversationMessage(parent, user.ID, receiver.ID) ||
+			parent.DeletedAt != nil || (parent.ExpiresAt != nil && parent.ExpiresAt.Before(time.Now())) {
+			return nil, nil, &requestError{http.StatusBadRequest, "Replied-to message not found in this conversation"}
+		}
+	}
+
+	if (req.Poll != nil) != (req.Type == models.MessageTypePoll) {
+		return nil, nil, &requestError{http.StatusBadRequest, "Polls need a poll and only polls may have one"}
+	}
+
+	// Run text through the content filter before it is stored
+	var filtered filter.Result
+	if req.Type == "text" || req.Type == models.MessageTypePoll {
+		filtered = filter.Check(req.Content, user.ID, receiver.ID)
+		if filtered.Rejected {
+			return nil, nil, &requestError{http.StatusUnprocessableEntity, "Message blocked by content filter"}
+		}
+		req.Content = filtered.Content
+	}
+
+	var poll *database.NewPoll
+	if req.Type == models.MessageTypePoll {
+		if req.SendAt != nil {
+			return nil, nil, &requestError{http.StatusBadRequest, "Polls cannot be scheduled"}
+		}
+		var err error
+		if poll, err = validatePoll(req.Content, req.Poll, user.ID, receiver.ID, &filtered); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if req.Replays < 0 || req.Replays > maxSnapReplays || (req.Replays > 0 && req.Type != models.MessageTypeSnap) {
+		return nil, nil, &requestError{http.StatusBadRequest, "Invalid replays"}
+	}
+
+	// Set expiration for one-off disappearing messages (see Disappear). Unopened snaps are
+	// purged once they time out. The conversation's disappearing timer is
+	// applied on top when the message is stored.
+	var lifetime time.Duration
 	if req.Disappear {
-		t := time.Now().Add(24 * time.Hour)
+		lifetime = 24 * time.Hour
+	}
+	if req.Type == models.MessageTypeSnap {
+		lifetime = snapTimeout()
+	}
+
+	if req.SendAt != nil {
+		scheduled, err := scheduleMessage(user, receiver, req, lifetime, filtered)
+		return nil, scheduled, err
+	}
+
+	var expiresAt *time.Time
+	if lifetime > 0 {
+		t := time.Now().Add(lifetime)
 		expiresAt = &t
 	}
 
-	message, err := database.CreateMessage(user.ID, receiver.ID, req.Content, req.Type, expiresAt)
+	message, err := database.CreateMessage(database.NewMessage{
+		SenderID:           user.ID,
+		ReceiverID:         receiver.ID,
+		Content:            req.Content,
+		Type:               req.Type,
+		Format:             req.Format,
+		ContentHTML:        renderContent(req.Format, req.Content),
+		ExpiresAt:          expiresAt,
+		RepliedToMessageID: req.RepliedToMessageID,
+		MaxViews:           1 + req.Replays,
+		ClientMsgID:        req.ClientMsgID,
+		Poll:               poll,
+	})
+	if err == sql.ErrNoRows {
+		// A concurrent retry created it first
+		existing, err := originalMessage(user, req.ClientMsgID)
+		if err != nil {
+			return nil, nil, &requestError{http.StatusInternalServerError, "Failed to send message"}
+		}
+		return existing, nil, nil
+	}
 	if err != nil {
-		http.Error(w, `{"error": "Failed to send message"}`, http.StatusInternalServerError)
-		return
+		return nil, nil, &requestError{http.StatusInternalServerError, "Failed to send message"}
+	}
+
+	if filtered.Flagged {
+		auditFlaggedMessage(user.ID, fmt.Sprintf("message %d", message.ID), filtered)
+	}
+
+	if poll != nil {
+		// Nobody has voted yet, so the sender's view fits the receiver too
+		if message.Poll, err = database.GetPoll(message.ID, user.ID); err != nil {
+			log.Printf("Failed to load poll %d: %v", message.ID, err)
+		}
+	}
+
+	publishMessage(user, receiver, message)
+
+	return message, nil, nil
+}
+
+// originalMessage returns the message user already sent with clientMsgID,
+// shaped like the response to the original send. It returns sql.ErrNoRows
+// if there is none within the idempotency window.
+func originalMessage(user *models.User, clientMsgID string) (*models.Message, error) {
+	existing, err := database.GetMessageByClientMsgID(user.ID, clientMsgID, idempotencyWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	existing.HideSnapContent()
+	if err := database.RedactReadReceipt(existing, user.ID); err != nil {
+		return nil, err
+	}
+	if existing.Type == models.MessageTypePoll {
+		if existing.Poll, err = database.GetPoll(existing.ID, user.ID); err != nil {
+			log.Printf("Failed to load poll %d: %v", existing.ID, err)
+		}
+	}
+	return existing, nil
+}
+
+// publishMessage delivers a newly stored message to its receiver over the
+// hub, notifies mentioned users and unarchives the conversation. It fills in
+// mentions on message and hides snap content from it.
+func publishMessage(sender, receiver *models.User, message *models.Message) *models.MessageWithSender {
+	// Resolve @mentions against the people in this conversation
+	var mentioned []int64
+	if message.Type == "text" {
+		mentioned = resolveMentions(message.Content, []*models.User{receiver})
+		if len(mentioned) > 0 {
+			if err := database.CreateMentions(message.ID, mentioned); err != nil {
+				log.Printf("Failed to save mentions for message %d: %v", message.ID, err)
+				mentioned = nil
+			}
+			message.Mentions = mentioned
+		}
+	}
+
+	// Snap media is only handed out by the open endpoint
+	message.HideSnapContent()
+
+	outgoing := &models.MessageWithSender{
+		Message:        *message,
+		SenderUsername: sender.Username,
+		SenderAvatar:   sender.Avatar,
+	}
+	if message.RepliedToMessageID != nil {
+		// Built for the receiver, who gets the event
+		outgoing.ReplyTo, _ = database.GetMessagePreview(*message.RepliedToMessageID, receiver.ID)
 	}
 
 	// Broadcast via WebSocket
 	BroadcastMessage(receiver.ID, models.WebSocketMessage{
-		Type: "message",
-		Payload: models.MessageWithSender{
-			Message:        *message,
-			SenderUsername: user.Username,
-			SenderAvatar:   user.Avatar,
-		},
+		Type:    "message",
+		Payload: outgoing,
 	})
+	sendBadge(receiver.ID)
+	notifyMentions(outgoing, mentioned)
 
-	json.NewEncoder(w).Encode(message)
+	// The preview arrives later as a message_updated event
+	queueLinkPreview(message)
+
+	unarchiveConversation(sender.ID, receiver.ID)
+
+	return outgoing
+}
+
+// auditFlaggedMessage records that the content filter flagged what a user sent
+func auditFlaggedMessage(userID int64, subject string, filtered filter.Result) {
+	details := fmt.Sprintf("%s matched %v", subject, filtered.Matches)
+	if err := database.CreateAuditLog(nil, "message.flagged", &userID, details); err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
 }
 
-// MarkAsRead marks messages from a user as read
+// isConversationMessage reports whether msg was exchanged between the two users
+func isConversationMessage(msg *models.Message, userID, otherUserID int64) bool {
+	return (msg.SenderID == userID && msg.ReceiverID == otherUserID) ||
+		(msg.SenderID == otherUserID && msg.ReceiverID == userID)
+}
+
+// MarkAsRead marks messages from a user as read, optionally only up to
+// up_to_message_id
 func MarkAsRead(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -170,19 +483,341 @@ func MarkAsRead(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := database.MarkMessagesAsRead(senderID, user.ID); err != nil {
+	// The body is optional; without it everything is marked read
+	var req markReadRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	readIDs, err := markRead(user, senderID, req.UpToMessageID)
+	if err != nil {
 		http.Error(w, `{"error": "Failed to mark as read"}`, http.StatusInternalServerError)
 		return
 	}
 
-	// Notify sender that messages were read
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"message_ids": readIDs,
+	})
+}
+
+// markRead marks the messages senderID sent to user as read, up to
+// upToMessageID unless it is 0, and sends read receipts
+func markRead(user *models.User, senderID, upToMessageID int64) ([]int64, error) {
+	readIDs, err := database.MarkMessagesAsRead(senderID, user.ID, upToMessageID)
+	if err != nil {
+		return nil, err
+	}
+
+	sendReadReceipts(user, senderID, readIDs)
+
+	if len(readIDs) > 0 {
+		sendBadge(user.ID)
+	}
+
+	if readIDs == nil {
+		readIDs = []int64{}
+	}
+	return readIDs, nil
+}
+
+// sendReadReceipts tells the sender exactly which messages the reader has
+// read, unless the reader opted out of read receipts
+func sendReadReceipts(reader *models.User, senderID int64, messageIDs []int64) {
+	if len(messageIDs) == 0 || !reader.SendReadReceipts {
+		return
+	}
+
 	BroadcastMessage(senderID, models.WebSocketMessage{
 		Type: "read",
-		Payload: map[string]int64{
-			"reader_id": user.ID,
+		Payload: map[string]interface{}{
+			"reader_id":   reader.ID,
+			"message_ids": messageIDs,
+		},
+	})
+	BroadcastMessage(senderID, models.WebSocketMessage{
+		Type: "receipts",
+		Payload: map[string]interface{}{
+			"status":      models.MessageStatusRead,
+			"user_id":     reader.ID,
+			"message_ids": messageIDs,
 		},
 	})
+}
+
+// EditMessage changes the content of a message the current user sent
+func EditMessage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	messageID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, `{"error": "Invalid message ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	var req editMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.Content == "" {
+		http.Error(w, `{"error": "Message content is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	message, err := database.GetMessageByID(messageID)
+	if err != nil || message.SenderID != user.ID || message.DeletedAt != nil {
+		http.Error(w, `{"error": "Message not found"}`, http.StatusNotFound)
+		return
+	}
+
+	if message.Type != "text" {
+		http.Error(w, `{"error": "Only text messages can be edited"}`, http.StatusBadRequest)
+		return
+	}
+
+	if time.Since(message.CreatedAt) > messageEditWindow() {
+		http.Error(w, `{"error": "Edit window has passed"}`, http.StatusForbidden)
+		return
+	}
+
+	filtered := filter.Check(req.Content, message.SenderID, message.ReceiverID)
+	if filtered.Rejected {
+		http.Error(w, `{"error": "Message blocked by content filter"}`, http.StatusUnprocessableEntity)
+		return
+	}
 
-	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+	if filtered.Content == message.Content {
+		database.RedactReadReceipt(message, user.ID)
+		json.NewEncoder(w).Encode(message)
+		return
+	}
+
+	receiver, err := database.GetUserByID(message.ReceiverID)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to edit message"}`, http.StatusInternalServerError)
+		return
+	}
+
+	// Mentions and the link preview follow the new content
+	mentioned := resolveMentions(filtered.Content, []*models.User{receiver})
+	newURL := linkpreview.FindURL(filtered.Content)
+	urlChanged := newURL != linkpreview.FindURL(message.Content)
+	previouslyMentioned := message.Mentions
+
+	message, err = database.EditMessage(message.ID, user.ID, filtered.Content, renderContent(message.Format, filtered.Content),
+		mentioned, urlChanged, messageEditWindow())
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "Edit window has passed"}`, http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error": "Failed to edit message"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if filtered.Flagged {
+		details := fmt.Sprintf("message %d edit matched %v", message.ID, filtered.Matches)
+		if err := database.CreateAuditLog(nil, "message.flagged", &user.ID, details); err != nil {
+			log.Printf("Failed to write audit log: %v", err)
+		}
+	}
+
+	outgoing := &models.MessageWithSender{
+		Message:        *message,
+		SenderUsername: user.Username,
+		SenderAvatar:   user.Avatar,
+	}
+	BroadcastMessage(message.ReceiverID, models.WebSocketMessage{
+		Type:    "message_edited",
+		Payload: outgoing,
+	})
+
+	// Only people the edit newly mentions are notified
+	notifyMentions(outgoing, newMentions(mentioned, previouslyMentioned))
+
+	if urlChanged && newURL != "" {
+		queueLinkPreview(message)
+	}
+
+	database.RedactReadReceipt(message, user.ID)
+	json.NewEncoder(w).Encode(message)
+}
+
+// newMentions returns the IDs in mentioned that are not in previous
+func newMentions(mentioned, previous []int64) []int64 {
+	var added []int64
+	for _, id := range mentioned {
+		found := false
+		for _, p := range previous {
+			if p == id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			added = append(added, id)
+		}
+	}
+	return added
 }
 
+// GetMessageRevisions returns the edit history of a message to its participants
+func GetMessageRevisions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	messageID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, `{"error": "Invalid message ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	message, err := database.GetMessageByID(messageID)
+	if err != nil || (message.SenderID != user.ID && message.ReceiverID != user.ID) {
+		http.Error(w, `{"error": "Message not found"}`, http.StatusNotFound)
+		return
+	}
+
+	revisions, err := database.GetMessageRevisions(message.ID)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to get revisions"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if revisions == nil {
+		revisions = []models.MessageRevision{}
+	}
+
+	json.NewEncoder(w).Encode(revisions)
+}
+
+// DeleteMessage removes a message from the caller's view (?mode=me, the
+// default) or unsends it for both participants (?mode=everyone, sender only)
+func DeleteMessage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	messageID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, `{"error": "Invalid message ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	message, err := database.GetMessageByID(messageID)
+	if err != nil || (message.SenderID != user.ID && message.ReceiverID != user.ID) {
+		http.Error(w, `{"error": "Message not found"}`, http.StatusNotFound)
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	switch mode {
+	case "", "me":
+		mode = "me"
+		if err := database.HideMessageForUser(message.ID, user.ID); err != nil {
+			http.Error(w, `{"error": "Failed to delete message"}`, http.StatusInternalServerError)
+			return
+		}
+
+	case "everyone":
+		if message.SenderID != user.ID {
+			http.Error(w, `{"error": "Only the sender can delete for everyone"}`, http.StatusForbidden)
+			return
+		}
+		if message.DeletedAt == nil {
+			if err := database.UnsendMessage(message.ID); err != nil {
+				http.Error(w, `{"error": "Failed to delete message"}`, http.StatusInternalServerError)
+				return
+			}
+		}
+		BroadcastMessage(message.ReceiverID, models.WebSocketMessage{
+			Type: "message_deleted",
+			Payload: map[string]interface{}{
+				"message_id": message.ID,
+				"mode":       mode,
+			},
+		})
+
+	default:
+		http.Error(w, `{"error": "Invalid mode"}`, http.StatusBadRequest)
+		return
+	}
+
+	// An unread message going away changes the receiver's badge
+	if message.ReadAt == nil && (mode == "everyone" || user.ID == message.ReceiverID) {
+		sendBadge(message.ReceiverID)
+	}
+
+	// Keep the caller's other open views in sync
+	BroadcastMessage(user.ID, models.WebSocketMessage{
+		Type: "message_deleted",
+		Payload: map[string]interface{}{
+			"message_id": message.ID,
+			"mode":       mode,
+		},
+	})
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"mode":    mode,
+	})
+}
+
+// GetReplies returns every reply to a message (its thread)
+func GetReplies(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	messageID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, `{"error": "Invalid message ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	message, err := database.GetMessageByID(messageID)
+	if err != nil || (message.SenderID != user.ID && message.ReceiverID != user.ID) {
+		http.Error(w, `{"error": "Message not found"}`, http.StatusNotFound)
+		return
+	}
+
+	replies, err := database.GetReplies(message.ID, user.ID)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to get replies"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if replies == nil {
+		replies = []models.MessageWithSender{}
+	}
+
+	json.NewEncoder(w).Encode(replies)
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"scuffedsnap/database"
+	"scuffedsnap/middleware"
+	"scuffedsnap/models"
+)
+
+// defaultPinLimit is how many messages a conversation may have pinned
+// unless PINNED_MESSAGES_LIMIT overrides it
+const defaultPinLimit = 10
+
+func pinLimit() int {
+	if v := os.Getenv("PINNED_MESSAGES_LIMIT"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			return n
+		}
+		log.Printf("Invalid PINNED_MESSAGES_LIMIT %q, using default", v)
+	}
+	return defaultPinLimit
+}
+
+// PinMessage pins a message in the conversation it belongs to
+func PinMessage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	message, ok := participantMessage(w, r, user)
+	if !ok {
+		return
+	}
+
+	if message.Type == models.MessageTypeSnap {
+		http.Error(w, `{"error": "Snaps cannot be pinned"}`, http.StatusBadRequest)
+		return
+	}
+
+	changed, err := database.PinMessage(message.ID, user.ID, pinLimit())
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "Too many pinned messages in this conversation"}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error": "Failed to pin message"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if changed {
+		broadcastPinChange(message, user.ID, true)
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"message_id": message.ID,
+		"pinned":     true,
+	})
+}
+
+// UnpinMessage removes a message from its conversation's pins
+func UnpinMessage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	message, ok := participantMessage(w, r, user)
+	if !ok {
+		return
+	}
+
+	changed, err := database.UnpinMessage(message.ID)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to unpin message"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if changed {
+		broadcastPinChange(message, user.ID, false)
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"message_id": message.ID,
+		"pinned":     false,
+	})
+}
+
+// participantMessage loads the {id} message if user is one of its participants
+// and it is still live, writing an error response otherwise
+func participantMessage(w http.ResponseWriter, r *http.Request, user *models.User) (*models.Message, bool) {
+	vars := mux.Vars(r)
+	messageID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, `{"error": "Invalid message ID"}`, http.StatusBadRequest)
+		return nil, false
+	}
+
+	message, err := database.GetMessageByID(messageID)
+	if err != nil || (message.SenderID != user.ID && message.ReceiverID != user.ID) ||
+		message.DeletedAt != nil || (message.ExpiresAt != nil && message.ExpiresAt.Before(time.Now())) {
+		http.Error(w, `{"error": "Message not found"}`, http.StatusNotFound)
+		return nil, false
+	}
+	return message, true
+}
+
+// broadcastPinChange tells both participants' clients to refresh their
+// pinned bar
+func broadcastPinChange(message *models.Message, userID int64, pinned bool) {
+	eventType := "message_pinned"
+	if !pinned {
+		eventType = "message_unpinned"
+	}
+
+	event := models.WebSocketMessage{
+		Type: eventType,
+		Payload: map[string]interface{}{
+			"message_id": message.ID,
+			"user_id":    userID,
+			"pinned":     pinned,
+		},
+	}
+	BroadcastMessage(message.SenderID, event)
+	if message.ReceiverID != message.SenderID {
+		BroadcastMessage(message.ReceiverID, event)
+	}
+}
+
+// GetPinnedMessages returns the pinned messages of the conversation with {userId}
+func GetPinnedMessages(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	otherUserID, err := strconv.ParseInt(vars["userId"], 10, 64)
+	if err != nil {
+		http.Error(w, `{"error": "Invalid user ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	messages, err := database.GetPinnedMessages(user.ID, otherUserID)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to get pinned messages"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if messages == nil {
+		messages = []models.MessageWithSender{}
+	}
+
+	json.NewEncoder(w).Encode(messages)
+}
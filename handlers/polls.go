@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"scuffedsnap/database"
+	"scuffedsnap/middleware"
+	"scuffedsnap/models"
+	"scuffedsnap/pkg/filter"
+)
+
+const (
+	minPollOptions     = 2
+	maxPollOptions     = 10
+	maxPollOptionLen   = 100
+	maxPollQuestionLen = 300
+)
+
+type pollRequest struct {
+	Options        []string   `json:"options"`
+	MultipleChoice bool       `json:"multiple_choice"`
+	Anonymous      bool       `json:"anonymous"`
+	ClosesAt       *time.Time `json:"closes_at"`
+}
+
+type votePollRequest struct {
+	OptionID int64 `json:"option_id"`
+}
+
+// validatePoll checks a poll's question and options, running the options
+// through the content filter of the conversation between senderID and
+// receiverID as well. Filter matches are added to filtered.
+func validatePoll(question string, req *pollRequest, senderID, receiverID int64, filtered *filter.Result) (*database.NewPoll, error) {
+	if len([]rune(question)) > maxPollQuestionLen {
+		return nil, &requestError{http.StatusBadRequest, "Poll question is too long"}
+	}
+
+	if len(req.Options) < minPollOptions || len(req.Options) > maxPollOptions {
+		return nil, &requestError{http.StatusBadRequest, "Polls need 2-10 options"}
+	}
+
+	options := make([]string, len(req.Options))
+	seen := make(map[string]bool)
+	for i, option := range req.Options {
+		option = strings.TrimSpace(option)
+		if option == "" || len([]rune(option)) > maxPollOptionLen {
+			return nil, &requestError{http.StatusBadRequest, "Poll options must be 1-100 characters"}
+		}
+		if seen[strings.ToLower(option)] {
+			return nil, &requestError{http.StatusBadRequest, "Poll options must be unique"}
+		}
+		seen[strings.ToLower(option)] = true
+
+		result := filter.Check(option, senderID, receiverID)
+		if result.Rejected {
+			return nil, &requestError{http.StatusUnprocessableEntity, "Message blocked by content filter"}
+		}
+		if result.Flagged {
+			filtered.Flagged = true
+			filtered.Matches = append(filtered.Matches, result.Matches...)
+		}
+		options[i] = result.Content
+	}
+
+	if req.ClosesAt != nil && !req.ClosesAt.After(time.Now()) {
+		return nil, &requestError{http.StatusBadRequest, "closes_at must be in the future"}
+	}
+
+	return &database.NewPoll{
+		Options:        options,
+		MultipleChoice: req.MultipleChoice,
+		Anonymous:      req.Anonymous,
+		ClosesAt:       req.ClosesAt,
+	}, nil
+}
+
+// VotePoll casts the current user's vote for an option of a poll
+func VotePoll(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req votePollRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	updateVote(w, r, user, req.OptionID, true)
+}
+
+// UnvotePoll withdraws the current user's vote for option {optionId}
+func UnvotePoll(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	optionID, err := strconv.ParseInt(vars["optionId"], 10, 64)
+	if err != nil {
+		http.Error(w, `{"error": "Invalid option ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	updateVote(w, r, user, optionID, false)
+}
+
+func updateVote(w http.ResponseWriter, r *http.Request, user *models.User, optionID int64, vote bool) {
+	message, ok := pollMessage(w, r, user)
+	if !ok {
+		return
+	}
+
+	var changed bool
+	var err error
+	if vote {
+		changed, err = database.VotePoll(message.ID, optionID, user.ID)
+	} else {
+		changed, err = database.UnvotePoll(message.ID, optionID, user.ID)
+	}
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "Poll is closed or option not found"}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error": "Failed to update vote"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if changed {
+		broadcastPoll(message, "poll_updated")
+	}
+
+	poll, err := database.GetPoll(message.ID, user.ID)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to get poll"}`, http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(poll)
+}
+
+// ClosePoll ends a poll before its close time (poll author only). The
+// results are final from then on.
+func ClosePoll(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	message, ok := pollMessage(w, r, user)
+	if !ok {
+		return
+	}
+
+	if message.SenderID != user.ID {
+		http.Error(w, `{"error": "Only the author can close a poll"}`, http.StatusForbidden)
+		return
+	}
+
+	closed, err := database.ClosePoll(message.ID)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to close poll"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if closed {
+		broadcastPoll(message, "poll_closed")
+	}
+
+	poll, err := database.GetPoll(message.ID, user.ID)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to get poll"}`, http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(poll)
+}
+
+// pollMessage loads the {id} poll if user is one of its participants,
+// writing an error response otherwise
+func pollMessage(w http.ResponseWriter, r *http.Request, user *models.User) (*models.Message, bool) {
+	vars := mux.Vars(r)
+	messageID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, `{"error": "Invalid message ID"}`, http.StatusBadRequest)
+		return nil, false
+	}
+
+	message, err := database.GetMessageByID(messageID)
+	if err != nil || (message.SenderID != user.ID && message.ReceiverID != user.ID) ||
+		message.DeletedAt != nil || message.Type != models.MessageTypePoll {
+		http.Error(w, `{"error": "Poll not found"}`, http.StatusNotFound)
+		return nil, false
+	}
+	return message, true
+}
+
+// broadcastPoll sends the current tallies to both participants, each from
+// their own point of view
+func broadcastPoll(message *models.Message, eventType string) {
+	participants := []int64{message.SenderID}
+	if message.ReceiverID != message.SenderID {
+		participants = append(participants, message.ReceiverID)
+	}
+
+	for _, userID := range participants {
+		poll, err := database.GetPoll(message.ID, userID)
+		if err != nil {
+			log.Printf("Failed to load poll %d: %v", message.ID, err)
+			return
+		}
+		BroadcastMessage(userID, models.WebSocketMessage{
+			Type: eventType,
+			Payload: map[string]interface{}{
+				"message_id": message.ID,
+				"poll":       poll,
+			},
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"scuffedsnap/database"
+	"scuffedsnap/middleware"
+	"scuffedsnap/models"
+	"scuffedsnap/pkg/push"
+)
+
+// maxPushFieldLength bounds the endpoint and key strings a browser sends
+const maxPushFieldLength = 2048
+
+// PushSubscriptionStore serves push subscriptions from our own database,
+// keyed by local user ID. Install it with push.SetSubscriptionStore when
+// the database API is enabled.
+type PushSubscriptionStore struct{}
+
+// Subscriptions returns a local user's subscriptions, or all of them for ""
+func (PushSubscriptionStore) Subscriptions(userID string) ([]push.PushSubscriptionStruct, error) {
+	var stored []models.PushSubscription
+	var err error
+	if userID == "" {
+		stored, err = database.GetAllPushSubscriptions()
+	} else {
+		id, parseErr := strconv.ParseInt(userID, 10, 64)
+		if parseErr != nil {
+			// Not a local user, so there is nothing stored for it
+			return nil, nil
+		}
+		stored, err = database.GetPushSubscriptions(id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var subs []push.PushSubscriptionStruct
+	for _, s := range stored {
+		var sub push.PushSubscriptionStruct
+		sub.Endpoint = s.Endpoint
+		sub.Keys.P256dh = s.P256dh
+		sub.Keys.Auth = s.Auth
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+// Delete forgets an endpoint the push service rejected
+func (PushSubscriptionStore) Delete(endpoint string) {
+	if err := database.DeletePushSubscription(endpoint); err != nil {
+		log.Printf("Failed to delete push subscription: %v", err)
+	}
+}
+
+// SubscribePush stores the browser push subscription in the request body
+// (the JSON form of a PushSubscription) for the current user
+func SubscribePush(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var sub push.PushSubscriptionStruct
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	if !validPushEndpoint(sub.Endpoint) || sub.Keys.P256dh == "" || sub.Keys.Auth == "" ||
+		len(sub.Keys.P256dh) > maxPushFieldLength || len(sub.Keys.Auth) > maxPushFieldLength {
+		http.Error(w, `{"error": "Invalid push subscription"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := database.SavePushSubscription(user.ID, sub.Endpoint, sub.Keys.P256dh, sub.Keys.Auth); err != nil {
+		http.Error(w, `{"error": "Failed to save push subscription"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// UnsubscribePush removes one of the current user's push subscriptions
+func UnsubscribePush(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Endpoint string `json:"endpoint"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Endpoint == "" {
+		http.Error(w, `{"error": "Endpoint is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := database.DeleteUserPushSubscription(user.ID, req.Endpoint); err != nil {
+		http.Error(w, `{"error": "Failed to remove push subscription"}`, http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// validPushEndpoint accepts only URLs of the known browser push services,
+// since the server will later POST to them
+func validPushEndpoint(endpoint string) bool {
+	if endpoint == "" || len(endpoint) > maxPushFieldLength {
+		return false
+	}
+	return push.AllowedEndpoint(endpoint)
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+
+	"scuffedsnap/database"
+	"scuffedsnap/middleware"
+	"scuffedsnap/models"
+)
+
+type reactionRequest struct {
+	Emoji string `json:"emoji"`
+}
+
+// customEmojiPattern matches custom emoji codes such as ":partyparrot:"
+var customEmojiPattern = regexp.MustCompile(`^:([a-z0-9_+-]{1,32}):$`)
+
+// isValidReaction accepts exactly one standard emoji (including ZWJ
+// sequences, skin tones, keycaps and flags) or a custom emoji code listed
+// in CUSTOM_EMOJI_CODES
+func isValidReaction(emoji string) bool {
+	if m := customEmojiPattern.FindStringSubmatch(emoji); m != nil {
+		for _, code := range strings.Split(os.Getenv("CUSTOM_EMOJI_CODES"), ",") {
+			if strings.TrimSpace(code) == m[1] {
+				return true
+			}
+		}
+		return false
+	}
+
+	if emoji == "" || len(emoji) > 32 || !utf8.ValidString(emoji) {
+		return false
+	}
+
+	// A single emoji is one element, or elements joined by ZWJ
+	runes := []rune(emoji)
+	i := 0
+	for {
+		n := emojiElement(runes[i:])
+		if n == 0 {
+			return false
+		}
+		i += n
+		if i == len(runes) {
+			return true
+		}
+		if runes[i] != 0x200D || i+1 == len(runes) {
+			return false
+		}
+		i++
+	}
+}
+
+// emojiElement returns how many runes at the start of runes form one emoji
+// without joiners, or 0 if they do not start with one
+func emojiElement(runes []rune) int {
+	r := runes[0]
+	switch {
+	case isRegionalIndicator(r):
+		// Flags are exactly two regional indicators
+		if len(runes) >= 2 && isRegionalIndicator(runes[1]) {
+			return 2
+		}
+		return 0
+
+	case r >= '0' && r <= '9' || r == '#' || r == '*':
+		// Keycaps: base, optional VS16, combining enclosing keycap
+		i := 1
+		if i < len(runes) && runes[i] == 0xFE0F {
+			i++
+		}
+		if i < len(runes) && runes[i] == 0x20E3 {
+			return i + 1
+		}
+		return 0
+
+	case isPictograph(r) && !isSkinTone(r):
+		i := 1
+		if i < len(runes) && (runes[i] == 0xFE0F || runes[i] == 0xFE0E) {
+			i++
+		}
+		if i < len(runes) && isSkinTone(runes[i]) {
+			i++
+		}
+		// Subdivision flags: black flag, tag characters, cancel tag
+		if r == 0x1F3F4 && i < len(runes) && runes[i] >= 0xE0020 && runes[i] <= 0xE007E {
+			for i < len(runes) && runes[i] >= 0xE0020 && runes[i] <= 0xE007E {
+				i++
+			}
+			if i == len(runes) || runes[i] != 0xE007F {
+				return 0
+			}
+			i++
+		}
+		return i
+	}
+	return 0
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+func isSkinTone(r rune) bool {
+	return r >= 0x1F3FB && r <= 0x1F3FF
+}
+
+func isPictograph(r rune) bool {
+	switch {
+	case r >= 0x1F000 && r <= 0x1FAFF: // Emoticons, symbols, flags, skin tones
+		return true
+	case r >= 0x2300 && r <= 0x23FF, r >= 0x2600 && r <= 0x27BF, r >= 0x2B00 && r <= 0x2BFF:
+		return true
+	case r >= 0x2190 && r <= 0x21FF, r >= 0x25A0 && r <= 0x25FF, r == 0x2934, r == 0x2935:
+		return true
+	case r == 0x00A9, r == 0x00AE, r == 0x203C, r == 0x2049, r == 0x2122, r == 0x2139, r == 0x24C2:
+		return true
+	case r == 0x3030, r == 0x303D, r == 0x3297, r == 0x3299:
+		return true
+	}
+	return false
+}
+
+// AddReaction adds the current user's emoji reaction to a message
+func AddReaction(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req reactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	updateReaction(w, r, user, req.Emoji, true)
+}
+
+// RemoveReaction removes the current user's emoji reaction (?emoji=) from a message
+func RemoveReaction(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	updateReaction(w, r, user, r.URL.Query().Get("emoji"), false)
+}
+
+func updateReaction(w http.ResponseWriter, r *http.Request, user *models.User, emoji string, add bool) {
+	vars := mux.Vars(r)
+	messageID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, `{"error": "Invalid message ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	if !isValidReaction(emoji) {
+		http.Error(w, `{"error": "Invalid emoji"}`, http.StatusBadRequest)
+		return
+	}
+
+	message, err := database.GetMessageByID(messageID)
+	if err != nil || (message.SenderID != user.ID && message.ReceiverID != user.ID) || message.DeletedAt != nil {
+		http.Error(w, `{"error": "Message not found"}`, http.StatusNotFound)
+		return
+	}
+
+	var changed bool
+	eventType := "reaction_added"
+	if add {
+		changed, err = database.AddReaction(message.ID, user.ID, emoji)
+	} else {
+		eventType = "reaction_removed"
+		changed, err = database.RemoveReaction(message.ID, user.ID, emoji)
+	}
+	if err != nil {
+		http.Error(w, `{"error": "Failed to update reaction"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if changed {
+		event := models.WebSocketMessage{
+			Type: eventType,
+			Payload: map[string]interface{}{
+				"message_id": message.ID,
+				"user_id":    user.ID,
+				"emoji":      emoji,
+			},
+		}
+		BroadcastMessage(message.SenderID, event)
+		if message.ReceiverID != message.SenderID {
+			BroadcastMessage(message.ReceiverID, event)
+		}
+	}
+
+	summaries, err := database.GetReactionSummaries([]int64{message.ID}, user.ID)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to get reactions"}`, http.StatusInternalServerError)
+		return
+	}
+
+	reactions := summaries[message.ID]
+	if reactions == nil {
+		reactions = []models.ReactionSummary{}
+	}
+
+	json.NewEncoder(w).Encode(reactions)
+}
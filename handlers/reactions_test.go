@@ -0,0 +1,49 @@
+package handlers
+
+import "testing"
+
+func TestIsValidReaction(t *testing.T) {
+	t.Setenv("CUSTOM_EMOJI_CODES", "partyparrot, blobcat")
+
+	tests := []struct {
+		name  string
+		emoji string
+		want  bool
+	}{
+		{"basic emoji", "😀", true},
+		{"text symbol with VS16", "\u2764\uFE0F", true},
+		{"skin tone", "👍🏽", true},
+		{"ZWJ family", "\U0001F468\u200D\U0001F469\u200D\U0001F467", true},
+		{"ZWJ with skin tones", "\U0001F9D1\U0001F3FB\u200D\U0001F91D\u200D\U0001F9D1\U0001F3FF", true},
+		{"ZWJ with VS16", "\U0001F3F3\uFE0F\u200D\U0001F308", true},
+		{"country flag", "🇳🇱", true},
+		{"subdivision flag", "\U0001F3F4\U000E0067\U000E0062\U000E0073\U000E0063\U000E0074\U000E007F", true},
+		{"keycap", "1\uFE0F\u20E3", true},
+		{"keycap without VS16", "#\u20E3", true},
+		{"custom code", ":partyparrot:", true},
+
+		{"empty", "", false},
+		{"two emoji", "😀😀", false},
+		{"emoji and text", "😀a", false},
+		{"plain text", "ok", false},
+		{"bare digit", "1", false},
+		{"lone skin tone", "🏽", false},
+		{"lone regional indicator", "🇳", false},
+		{"three regional indicators", "🇳🇱🇳", false},
+		{"two flags", "🇳🇱🇧🇪", false},
+		{"trailing ZWJ", "\U0001F468\u200D", false},
+		{"leading ZWJ", "\u200D\U0001F468", false},
+		{"double ZWJ", "\U0001F468\u200D\u200D\U0001F469", false},
+		{"unterminated tag sequence", "\U0001F3F4\U000E0067\U000E0062", false},
+		{"tags on other emoji", "\U0001F600\U000E0067\U000E0062\U000E007F", false},
+		{"unknown custom code", ":nope:", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isValidReaction(tt.emoji); got != tt.want {
+				t.Errorf("isValidReaction(%q) = %v, want %v", tt.emoji, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"scuffedsnap/database"
+	"scuffedsnap/middleware"
+	"scuffedsnap/models"
+)
+
+type createReportRequest struct {
+	MessageID *int64 `json:"message_id"`
+	UserID    int64  `json:"user_id"` // Reported user, required when no message is given
+	Reason    string `json:"reason"`
+}
+
+type resolveReportRequest struct {
+	Action string `json:"action"` // "delete_message", "warn", "disable_user", "dismiss"
+	Note   string `json:"note"`
+}
+
+// CreateReport files a report about a message or a user
+func CreateReport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req createReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" || len(req.Reason) > 1000 {
+		http.Error(w, `{"error": "Reason must be 1-1000 characters"}`, http.StatusBadRequest)
+		return
+	}
+
+	var msg *models.Message
+	reportedUserID := req.UserID
+	if req.MessageID != nil {
+		m, err := database.GetMessageByID(*req.MessageID)
+		if err != nil {
+			http.Error(w, `{"error": "Message not found"}`, http.StatusNotFound)
+			return
+		}
+
+		// Users can only report messages they were part of
+		if m.SenderID != user.ID && m.ReceiverID != user.ID {
+			http.Error(w, `{"error": "Message not found"}`, http.StatusNotFound)
+			return
+		}
+		msg = m
+		reportedUserID = m.SenderID
+	}
+
+	if reportedUserID == user.ID {
+		http.Error(w, `{"error": "You cannot report yourself"}`, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := database.GetUserByID(reportedUserID); err != nil {
+		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
+		return
+	}
+
+	report, err := database.CreateReport(user.ID, reportedUserID, msg, req.Reason)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to create report"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(report)
+}
+
+// GetReports returns the moderation queue (admin only)
+func GetReports(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	status := models.ReportStatus(r.URL.Query().Get("status"))
+	switch status {
+	case "":
+		status = models.ReportStatusOpen
+	case "all":
+		status = ""
+	case models.ReportStatusOpen, models.ReportStatusActioned, models.ReportStatusDismissed:
+	default:
+		http.Error(w, `{"error": "Invalid status"}`, http.StatusBadRequest)
+		return
+	}
+
+	limit := 50
+	offset := 0
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 100 {
+			limit = parsed
+		}
+	}
+	if o := r.URL.Query().Get("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+
+	reports, err := database.GetReports(status, limit, offset)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to get reports"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if reports == nil {
+		reports = []models.Report{}
+	}
+
+	json.NewEncoder(w).Encode(reports)
+}
+
+// ResolveReport applies a moderation action to an open report (admin only)
+func ResolveReport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	moderator := middleware.GetUserFromContext(r)
+	if moderator == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	reportID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, `{"error": "Invalid report ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	var req resolveReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	status := models.ReportStatusActioned
+	switch req.Action {
+	case models.ReportActionDeleteMessage, models.ReportActionWarn, models.ReportActionDisableUser:
+	case models.ReportActionDismiss:
+		status = models.ReportStatusDismissed
+	default:
+		http.Error(w, `{"error": "Invalid action"}`, http.StatusBadRequest)
+		return
+	}
+
+	report, err := database.GetReportByID(reportID)
+	if err != nil {
+		http.Error(w, `{"error": "Report not found"}`, http.StatusNotFound)
+		return
+	}
+
+	var msg *models.Message
+	if req.Action == models.ReportActionDeleteMessage {
+		if report.MessageID == nil {
+			http.Error(w, `{"error": "Report has no message to delete"}`, http.StatusBadRequest)
+			return
+		}
+		if msg, err = database.GetMessageByID(*report.MessageID); err != nil {
+			http.Error(w, `{"error": "Message no longer exists"}`, http.StatusNotFound)
+			return
+		}
+	}
+
+	// The report is claimed and acted on in one transaction, so only one of
+	// several concurrent resolves gets to act
+	report, err = database.ResolveReport(reportID, moderator.ID, status, req.Action, req.Note)
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "Report already resolved"}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error": "Failed to resolve report"}`, http.StatusInternalServerError)
+		return
+	}
+
+	notifyReportAction(report, msg, req)
+
+	// Reporters who are offline see the outcome in GET /reports
+	BroadcastMessage(report.ReporterID, models.WebSocketMessage{
+		Type: "report_resolved",
+		Payload: map[string]interface{}{
+			"report_id": report.ID,
+			"status":    status,
+		},
+	})
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"status":  status,
+	})
+}
+
+// notifyReportAction tells the affected users about a moderator's decision
+// once it is committed. msg is the deleted message, if any.
+func notifyReportAction(report *models.Report, msg *models.Message, req resolveReportRequest) {
+	switch req.Action {
+	case models.ReportActionDeleteMessage:
+		for _, participant := range []int64{msg.SenderID, msg.ReceiverID} {
+			BroadcastMessage(participant, models.WebSocketMessage{
+				Type: "message_deleted",
+				Payload: map[string]interface{}{
+					"message_id": msg.ID,
+					"mode":       "everyone",
+				},
+			})
+		}
+
+	case models.ReportActionWarn:
+		BroadcastMessage(report.ReportedUserID, models.WebSocketMessage{
+			Type: "warning",
+			Payload: map[string]interface{}{
+				"report_id": report.ID,
+				"message":   req.Note,
+			},
+		})
+
+	case models.ReportActionDisableUser:
+		DisconnectUser(report.ReportedUserID, "Account disabled")
+	}
+}
+
+// GetMyReports returns the reports the current user filed along with how
+// they were resolved
+func GetMyReports(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	limit := 50
+	offset := 0
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 100 {
+			limit = parsed
+		}
+	}
+	if o := r.URL.Query().Get("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+
+	reports, err := database.GetReportsByReporter(user.ID, limit, offset)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to get reports"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if reports == nil {
+		reports = []models.Report{}
+	}
+	for i := range reports {
+		reports[i].HideModeration()
+	}
+
+	json.NewEncoder(w).Encode(reports)
+}
+
+// GetAuditLog returns recent administrative actions (admin only)
+func GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	limit := 50
+	offset := 0
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 100 {
+			limit = parsed
+		}
+	}
+	if o := r.URL.Query().Get("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+
+	entries, err := database.GetAuditLog(limit, offset)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to get audit log"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if entries == nil {
+		entries = []models.AuditLogEntry{}
+	}
+
+	json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"scuffedsnap/middleware"
+)
+
+// NewAPIRouter builds the router for the session-authenticated JSON API
+func NewAPIRouter() *mux.Router {
+	r := mux.NewRouter()
+	api := r.PathPrefix("/api").Subrouter()
+
+	// Public auth routes
+	api.HandleFunc("/auth/signup", Signup).Methods("POST")
+	api.HandleFunc("/auth/login", Login).Methods("POST")
+	api.HandleFunc("/auth/logout", Logout).Methods("POST")
+	api.Handle("/auth/session", middleware.OptionalAuth(http.HandlerFunc(GetSession))).Methods("GET")
+
+	// Authenticated routes
+	authed := api.NewRoute().Subrouter()
+	authed.Use(middleware.Auth)
+
+	authed.HandleFunc("/auth/me", Me).Methods("GET")
+
+	authed.HandleFunc("/users/search", SearchUsers).Methods("GET")
+	authed.HandleFunc("/users/online", GetOnlineUsers).Methods("GET")
+	authed.HandleFunc("/users/me/settings", GetUserSettings).Methods("GET")
+	authed.HandleFunc("/users/me/settings", UpdateUserSettings).Methods("PATCH")
+	authed.HandleFunc("/push/subscriptions", SubscribePush).Methods("POST")
+	authed.HandleFunc("/push/subscriptions", UnsubscribePush).Methods("DELETE")
+
+	authed.HandleFunc("/friends", GetFriends).Methods("GET")
+	authed.HandleFunc("/friends", AddFriend).Methods("POST")
+	authed.HandleFunc("/friends/requests", GetFriendRequests).Methods("GET")
+	authed.HandleFunc("/friends/{id}/accept", AcceptFriend).Methods("POST")
+	authed.HandleFunc("/friends/{id}", RemoveFriend).Methods("DELETE")
+
+	authed.HandleFunc("/conversations", GetConversations).Methods("GET")
+	authed.HandleFunc("/conversations/{userId}", UpdateConversation).Methods("PATCH")
+	authed.HandleFunc("/conversations/{userId}/pins", GetPinnedMessages).Methods("GET")
+	authed.HandleFunc("/conversations/{userId}/disappearing", GetDisappearingTimer).Methods("GET")
+	authed.HandleFunc("/conversations/{userId}/disappearing", SetDisappearingTimer).Methods("PUT")
+	authed.HandleFunc("/conversations/{userId}/disappearing/accept", AcceptDisappearingTimer).Methods("POST")
+	authed.HandleFunc("/conversations/{userId}/disappearing/proposal", DeclineDisappearingTimer).Methods("DELETE")
+	authed.HandleFunc("/drafts", GetDrafts).Methods("GET")
+	authed.HandleFunc("/drafts/{userId}", GetDraft).Methods("GET")
+	authed.HandleFunc("/drafts/{userId}", SaveDraft).Methods("PUT")
+	authed.HandleFunc("/drafts/{userId}", ClearDraft).Methods("DELETE")
+	authed.HandleFunc("/messages", SendMessage).Methods("POST")
+	authed.HandleFunc("/messages/{userId}", GetMessages).Methods("GET")
+	authed.HandleFunc("/messages/{userId}/read", MarkAsRead).Methods("POST")
+	authed.HandleFunc("/messages/{id}", EditMessage).Methods("PATCH")
+	authed.HandleFunc("/messages/{id}", DeleteMessage).Methods("DELETE")
+	authed.HandleFunc("/messages/{id}/revisions", GetMessageRevisions).Methods("GET")
+	authed.HandleFunc("/messages/{id}/replies", GetReplies).Methods("GET")
+	authed.HandleFunc("/messages/{id}/reactions", AddReaction).Methods("POST")
+	authed.HandleFunc("/messages/{id}/reactions", RemoveReaction).Methods("DELETE")
+	authed.HandleFunc("/messages/{id}/open", OpenSnap).Methods("POST")
+	authed.HandleFunc("/messages/{id}/forward", ForwardMessage).Methods("POST")
+	authed.HandleFunc("/messages/{id}/votes", VotePoll).Methods("POST")
+	authed.HandleFunc("/messages/{id}/votes/{optionId}", UnvotePoll).Methods("DELETE")
+	authed.HandleFunc("/messages/{id}/close", ClosePoll).Methods("POST")
+	authed.HandleFunc("/messages/{id}/pin", PinMessage).Methods("POST")
+	authed.HandleFunc("/messages/{id}/pin", UnpinMessage).Methods("DELETE")
+	authed.HandleFunc("/messages/{id}/star", StarMessage).Methods("POST")
+	authed.HandleFunc("/messages/{id}/star", UnstarMessage).Methods("DELETE")
+	authed.HandleFunc("/starred", GetStarredMessages).Methods("GET")
+	authed.HandleFunc("/scheduled-messages", GetScheduledMessages).Methods("GET")
+	authed.HandleFunc("/scheduled-messages/{id}", UpdateScheduledMessage).Methods("PATCH")
+	authed.HandleFunc("/scheduled-messages/{id}", CancelScheduledMessage).Methods("DELETE")
+
+	authed.HandleFunc("/mentions", GetMentions).Methods("GET")
+	authed.HandleFunc("/badge", GetBadge).Methods("GET")
+
+	authed.HandleFunc("/reports", CreateReport).Methods("POST")
+	authed.HandleFunc("/reports", GetMyReports).Methods("GET")
+	authed.HandleFunc("/announcements", GetAnnouncements).Methods("GET")
+
+	// Admin routes
+	admin := authed.PathPrefix("/admin").Subrouter()
+	admin.Use(middleware.Admin)
+
+	admin.HandleFunc("/disable-user", DisableUser).Methods("POST")
+	admin.HandleFunc("/reports", GetReports).Methods("GET")
+	admin.HandleFunc("/reports/{id}/resolve", ResolveReport).Methods("POST")
+	admin.HandleFunc("/audit-log", GetAuditLog).Methods("GET")
+	admin.HandleFunc("/announcements", CreateAnnouncement).Methods("POST")
+
+	return r
+}
@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"scuffedsnap/database"
+	"scuffedsnap/middleware"
+	"scuffedsnap/models"
+	"scuffedsnap/pkg/filter"
+	"scuffedsnap/pkg/push"
+)
+
+// maxScheduleAhead is how far in the future a message may be scheduled
+const maxScheduleAhead = 365 * 24 * time.Hour
+
+// schedulerInterval is how often due scheduled messages are sent
+const schedulerInterval = 15 * time.Second
+
+type updateScheduledMessageRequest struct {
+	Content *string    `json:"content"`
+	SendAt  *time.Time `json:"send_at"`
+}
+
+// validSendAt reports whether a message may be scheduled for t
+func validSendAt(t time.Time) bool {
+	now := time.Now()
+	return t.After(now) && t.Before(now.Add(maxScheduleAhead))
+}
+
+// scheduleMessage stores a validated send request for later delivery.
+// lifetime is how long the message lives once sent, 0 for forever.
+func scheduleMessage(user, receiver *models.User, req *sendMessageRequest, lifetime time.Duration, filtered filter.Result) (*models.ScheduledMessage, error) {
+	if !validSendAt(*req.SendAt) {
+		return nil, &requestError{http.StatusBadRequest, "send_at must be in the future and within a year"}
+	}
+
+	var expireSeconds *int64
+	if lifetime > 0 {
+		secs := int64(lifetime.Seconds())
+		expireSeconds = &secs
+	}
+
+	scheduled, err := database.CreateScheduledMessage(&models.ScheduledMessage{
+		SenderID:           user.ID,
+		ReceiverID:         receiver.ID,
+		Content:            req.Content,
+		Type:               req.Type,
+		Format:             req.Format,
+		ContentHTML:        renderContent(req.Format, req.Content),
+		RepliedToMessageID: req.RepliedToMessageID,
+		MaxViews:           1 + req.Replays,
+		ExpireSeconds:      expireSeconds,
+		SendAt:             *req.SendAt,
+		ClientMsgID:        req.ClientMsgID,
+	})
+	if err == sql.ErrNoRows {
+		// A concurrent retry scheduled it first
+		existing, err := database.GetScheduledMessageByClientMsgID(user.ID, req.ClientMsgID, idempotencyWindow)
+		if err != nil {
+			return nil, &requestError{http.StatusInternalServerError, "Failed to schedule message"}
+		}
+		return existing, nil
+	}
+	if err != nil {
+		return nil, &requestError{http.StatusInternalServerError, "Failed to schedule message"}
+	}
+
+	if filtered.Flagged {
+		auditFlaggedMessage(user.ID, fmt.Sprintf("scheduled message %d", scheduled.ID), filtered)
+	}
+
+	return scheduled, nil
+}
+
+// GetScheduledMessages returns the current user's pending scheduled messages
+func GetScheduledMessages(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	scheduled, err := database.GetScheduledMessages(user.ID)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to get scheduled messages"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if scheduled == nil {
+		scheduled = []models.ScheduledMessage{}
+	}
+
+	json.NewEncoder(w).Encode(scheduled)
+}
+
+// UpdateScheduledMessage changes the content or send time of a pending
+// scheduled message
+func UpdateScheduledMessage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, `{"error": "Invalid scheduled message ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	var req updateScheduledMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	scheduled, err := database.GetScheduledMessage(id, user.ID)
+	if err != nil {
+		http.Error(w, `{"error": "Scheduled message not found"}`, http.StatusNotFound)
+		return
+	}
+
+	content := scheduled.Content
+	var filtered filter.Result
+	if req.Content != nil {
+		if *req.Content == "" {
+			http.Error(w, `{"error": "Message content is required"}`, http.StatusBadRequest)
+			return
+		}
+		content = *req.Content
+		if scheduled.Type == "text" {
+			filtered = filter.Check(content, scheduled.SenderID, scheduled.ReceiverID)
+			if filtered.Rejected {
+				http.Error(w, `{"error": "Message blocked by content filter"}`, http.StatusUnprocessableEntity)
+				return
+			}
+			content = filtered.Content
+		}
+	}
+
+	sendAt := scheduled.SendAt
+	if req.SendAt != nil {
+		if !validSendAt(*req.SendAt) {
+			http.Error(w, `{"error": "send_at must be in the future and within a year"}`, http.StatusBadRequest)
+			return
+		}
+		sendAt = *req.SendAt
+	}
+
+	updated, err := database.UpdateScheduledMessage(id, user.ID, content, renderContent(scheduled.Format, content), sendAt)
+	if err == sql.ErrNoRows {
+		// The scheduler got to it first
+		http.Error(w, `{"error": "Message was already sent"}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error": "Failed to update scheduled message"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if filtered.Flagged {
+		auditFlaggedMessage(user.ID, fmt.Sprintf("scheduled message %d", updated.ID), filtered)
+	}
+
+	json.NewEncoder(w).Encode(updated)
+}
+
+// CancelScheduledMessage deletes a pending scheduled message
+func CancelScheduledMessage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, `{"error": "Invalid scheduled message ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := database.DeleteScheduledMessage(id, user.ID)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to cancel scheduled message"}`, http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, `{"error": "Scheduled message not found"}`, http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// RunMessageScheduler sends scheduled messages once they are due. Pending
+// messages live in the database, so anything that came due while the
+// server was down goes out on the first pass.
+func RunMessageScheduler() {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		sendDueScheduledMessages()
+		<-ticker.C
+	}
+}
+
+func sendDueScheduledMessages() {
+	for {
+		scheduledID, message, err := database.SendDueScheduledMessage()
+		if err == sql.ErrNoRows {
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to send scheduled message: %v", err)
+			return
+		}
+
+		sender, err := database.GetUserByID(message.SenderID)
+		if err != nil {
+			log.Printf("Scheduled message %d sent without sender: %v", message.ID, err)
+			continue
+		}
+		receiver, err := database.GetUserByID(message.ReceiverID)
+		if err != nil {
+			log.Printf("Scheduled message %d sent without receiver: %v", message.ID, err)
+			continue
+		}
+
+		outgoing := publishMessage(sender, receiver, message)
+
+		// Let the sender's client swap the pending entry for the real message
+		BroadcastMessage(sender.ID, models.WebSocketMessage{
+			Type: "scheduled_message_sent",
+			Payload: map[string]interface{}{
+				"scheduled_message_id": scheduledID,
+				"message":              outgoing,
+			},
+		})
+
+		if !conversationMuted(receiver.ID, sender.ID) {
+			go push.SendToUser(strconv.FormatInt(receiver.ID, 10), push.Notification{
+				Title: sender.Username,
+				Body:  messagePushBody(message),
+				URL:   "/app",
+				Badge: badgeTotal(receiver.ID),
+			})
+		}
+	}
+}
+
+// messagePushBody summarizes a message for a push notification
+func messagePushBody(message *models.Message) string {
+	if message.Type != "text" {
+		return "Sent you a " + message.Type
+	}
+	// Cut by runes so multibyte characters are not split
+	if body := []rune(message.Content); len(body) > 50 {
+		return string(body[:50]) + "..."
+	}
+	return message.Content
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"scuffedsnap/models"
+)
+
+func TestMessagePushBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		message models.Message
+		want    string
+	}{
+		{"short text", models.Message{Type: "text", Content: "hi"}, "hi"},
+		{"exactly 50", models.Message{Type: "text", Content: strings.Repeat("a", 50)}, strings.Repeat("a", 50)},
+		{"long text", models.Message{Type: "text", Content: strings.Repeat("a", 60)}, strings.Repeat("a", 50) + "..."},
+		{"multibyte", models.Message{Type: "text", Content: strings.Repeat("é", 60)}, strings.Repeat("é", 50) + "..."},
+		{"emoji", models.Message{Type: "text", Content: strings.Repeat("😀", 51)}, strings.Repeat("😀", 50) + "..."},
+		{"media", models.Message{Type: "image", Content: "https://example.com/a.png"}, "Sent you a image"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := messagePushBody(&tt.message)
+			if got != tt.want {
+				t.Errorf("messagePushBody() = %q, want %q", got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("messagePushBody() = %q is not valid UTF-8", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"scuffedsnap/database"
+	"scuffedsnap/middleware"
+	"scuffedsnap/models"
+	"scuffedsnap/pkg/storage"
+)
+
+// maxSnapReplays is how many extra views a sender may allow on a snap
+const maxSnapReplays = 2
+
+// snapPurgeGrace is how long a snap's media stays available after its last
+// view, so the client can finish loading it
+const snapPurgeGrace = 30 * time.Second
+
+// defaultSnapTimeout is how long an unopened snap is kept unless
+// SNAP_TIMEOUT overrides it (e.g. "12h")
+const defaultSnapTimeout = 24 * time.Hour
+
+func snapTimeout() time.Duration {
+	if v := os.Getenv("SNAP_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+		log.Printf("Invalid SNAP_TIMEOUT %q, using default", v)
+	}
+	return defaultSnapTimeout
+}
+
+// OpenSnap returns a snap's content to its receiver, using up one view
+func OpenSnap(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	messageID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, `{"error": "Invalid message ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	message, err := database.GetMessageByID(messageID)
+	if err != nil || message.ReceiverID != user.ID || message.Type != models.MessageTypeSnap {
+		http.Error(w, `{"error": "Snap not found"}`, http.StatusNotFound)
+		return
+	}
+
+	// Stored media is handed out as a URL that expires with the purge
+	// grace. Signing first means a storage failure does not use up a view.
+	var signedURL string
+	if storage.IsStorageURL(message.Content) {
+		signedURL, err = storage.SignedURL(message.Content, snapPurgeGrace)
+		if err != nil {
+			log.Printf("Failed to sign media of snap %d: %v", message.ID, err)
+			http.Error(w, `{"error": "Failed to open snap"}`, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	opened, err := database.OpenSnap(message.ID, user.ID, snapPurgeGrace)
+	if err == sql.ErrNoRows {
+		http.Error(w, `{"error": "Snap is no longer available"}`, http.StatusGone)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error": "Failed to open snap"}`, http.StatusInternalServerError)
+		return
+	}
+	if signedURL != "" {
+		opened.Content = signedURL
+	}
+
+	BroadcastMessage(opened.SenderID, models.WebSocketMessage{
+		Type: "snap_opened",
+		Payload: map[string]interface{}{
+			"message_id": opened.ID,
+			"user_id":    user.ID,
+			"snap":       opened.Snap,
+		},
+	})
+
+	json.NewEncoder(w).Encode(opened)
+}
+
+// relaySnapScreenshot tells a snap's sender that the receiver's client
+// reported a screenshot of it
+func (c *Client) relaySnapScreenshot(rawID interface{}) {
+	receiverID, err := strconv.ParseInt(c.UserID, 10, 64)
+	if err != nil || database.DB == nil || !c.Authenticated {
+		return
+	}
+
+	id, ok := rawID.(float64)
+	if !ok {
+		return
+	}
+
+	message, err := database.GetMessageByID(int64(id))
+	if err != nil || message.ReceiverID != receiverID || message.Type != models.MessageTypeSnap {
+		return
+	}
+
+	BroadcastMessage(message.SenderID, models.WebSocketMessage{
+		Type: "snap_screenshot",
+		Payload: map[string]interface{}{
+			"message_id": message.ID,
+			"user_id":    receiverID,
+		},
+	})
+}
+
+// RunSnapJanitor periodically wipes snaps that were fully viewed or timed
+// out, deleting their stored media as well
+func RunSnapJanitor() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		purgeSnaps()
+	}
+}
+
+func purgeSnaps() {
+	snaps, err := database.PurgeSnaps()
+	if err != nil {
+		log.Printf("Failed to purge snaps: %v", err)
+		return
+	}
+
+	// Receivers of unopened snaps may still show them in their badge
+	unread := make(map[int64]bool)
+	for _, s := range snaps {
+		if !s.Opened {
+			unread[s.ReceiverID] = true
+		}
+
+		if storage.IsStorageURL(s.MediaPath) {
+			if err := storage.DeleteObject(s.MediaPath); err != nil {
+				log.Printf("Failed to delete media of snap %d: %v", s.ID, err)
+			}
+		}
+
+		// Opened snaps already produced a snap_opened event, unsent ones a
+		// message_deleted event
+		if s.Opened || s.Deleted {
+			continue
+		}
+		event := models.WebSocketMessage{
+			Type: "snap_expired",
+			Payload: map[string]interface{}{
+				"message_id": s.ID,
+			},
+		}
+		BroadcastMessage(s.SenderID, event)
+		BroadcastMessage(s.ReceiverID, event)
+	}
+
+	for userID := range unread {
+		sendBadge(userID)
+	}
+}
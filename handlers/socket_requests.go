@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"scuffedsnap/database"
+	"scuffedsnap/models"
+)
+
+// socketFrame is a request sent by a client over the WebSocket
+type socketFrame struct {
+	Type      string          `json:"type"`
+	RequestID string          `json:"request_id"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+type socketMarkReadRequest struct {
+	UserID        int64 `json:"user_id"` // Whose messages to mark read
+	UpToMessageID int64 `json:"up_to_message_id"`
+}
+
+type socketFetchHistoryRequest struct {
+	UserID int64 `json:"user_id"`
+	Limit  int   `json:"limit"`
+	Offset int   `json:"offset"`
+}
+
+// handleRequest runs a request frame and answers with an "ack" carrying the
+// result or an "error", both tagged with the frame's request ID
+func (c *Client) handleRequest(raw []byte) {
+	var frame socketFrame
+	if err := json.Unmarshal(raw, &frame); err != nil {
+		return
+	}
+
+	result, err := c.runRequest(&frame)
+	if err != nil {
+		status, message := http.StatusInternalServerError, "Internal server error"
+		if re, ok := err.(*requestError); ok {
+			status, message = re.Status, re.Message
+		}
+		c.reply("error", frame.RequestID, map[string]interface{}{
+			"status": status,
+			"error":  message,
+		})
+		return
+	}
+
+	c.reply("ack", frame.RequestID, result)
+}
+
+func (c *Client) runRequest(frame *socketFrame) (interface{}, error) {
+	user, err := c.currentUser()
+	if err != nil {
+		return nil, err
+	}
+
+	switch frame.Type {
+	case "send_message":
+		var req sendMessageRequest
+		if err := json.Unmarshal(frame.Payload, &req); err != nil {
+			return nil, &requestError{http.StatusBadRequest, "Invalid request body"}
+		}
+		message, scheduled, err := sendMessage(user, &req)
+		if err != nil {
+			return nil, err
+		}
+		if scheduled != nil {
+			return map[string]interface{}{"scheduled_message": scheduled}, nil
+		}
+		return map[string]interface{}{"message": message}, nil
+
+	case "mark_read":
+		var req socketMarkReadRequest
+		if err := json.Unmarshal(frame.Payload, &req); err != nil || req.UserID == 0 {
+			return nil, &requestError{http.StatusBadRequest, "Invalid request body"}
+		}
+		readIDs, err := markRead(user, req.UserID, req.UpToMessageID)
+		if err != nil {
+			return nil, &requestError{http.StatusInternalServerError, "Failed to mark as read"}
+		}
+		return map[string]interface{}{"message_ids": readIDs}, nil
+
+	case "fetch_history":
+		var req socketFetchHistoryRequest
+		if err := json.Unmarshal(frame.Payload, &req); err != nil || req.UserID == 0 {
+			return nil, &requestError{http.StatusBadRequest, "Invalid request body"}
+		}
+		if req.Limit <= 0 || req.Limit > 100 {
+			req.Limit = 50
+		}
+		if req.Offset < 0 {
+			req.Offset = 0
+		}
+		messages, err := fetchHistory(user, req.UserID, req.Limit, req.Offset)
+		if err != nil {
+			return nil, &requestError{http.StatusInternalServerError, "Failed to get messages"}
+		}
+		return map[string]interface{}{"messages": messages}, nil
+	}
+
+	return nil, &requestError{http.StatusBadRequest, "Unknown request type"}
+}
+
+// currentUser loads the connection's user fresh for every request, so a
+// disabled account cannot keep using an open socket
+func (c *Client) currentUser() (*models.User, error) {
+	if !c.Authenticated || database.DB == nil {
+		return nil, &requestError{http.StatusUnauthorized, "Unauthorized"}
+	}
+
+	id, err := strconv.ParseInt(c.UserID, 10, 64)
+	if err != nil {
+		return nil, &requestError{http.StatusUnauthorized, "Unauthorized"}
+	}
+
+	user, err := database.GetUserByID(id)
+	if err != nil {
+		return nil, &requestError{http.StatusUnauthorized, "Unauthorized"}
+	}
+	if user.IsDisabled {
+		return nil, &requestError{http.StatusForbidden, "Account disabled"}
+	}
+	return user, nil
+}
+
+// reply answers on this connection only, not the user's other devices
+func (c *Client) reply(frameType, requestID string, payload interface{}) {
+	broadcast(BroadcastPayload{UserID: c.UserID, Client: c}, models.WebSocketMessage{
+		Type:      frameType,
+		RequestID: requestID,
+		Payload:   payload,
+	})
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"scuffedsnap/database"
+	"scuffedsnap/middleware"
+	"scuffedsnap/models"
+)
+
+// StarMessage bookmarks a message for the current user
+func StarMessage(w http.ResponseWriter, r *http.Request) {
+	setStar(w, r, true)
+}
+
+// UnstarMessage removes the current user's bookmark from a message
+func UnstarMessage(w http.ResponseWriter, r *http.Request) {
+	setStar(w, r, false)
+}
+
+// starrableMessage loads the {id} message if user can still see it: they
+// are a participant, it is live and they have not hidden it. Stars are
+// private, so unlike pins hiding a message counts. It writes an error
+// response otherwise.
+func starrableMessage(w http.ResponseWriter, r *http.Request, user *models.User) (*models.Message, bool) {
+	message, ok := participantMessage(w, r, user)
+	if !ok {
+		return nil, false
+	}
+
+	hidden, err := database.IsMessageHidden(message.ID, user.ID)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to get message"}`, http.StatusInternalServerError)
+		return nil, false
+	}
+	if hidden {
+		http.Error(w, `{"error": "Message not found"}`, http.StatusNotFound)
+		return nil, false
+	}
+	return message, true
+}
+
+func setStar(w http.ResponseWriter, r *http.Request, starred bool) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	message, ok := starrableMessage(w, r, user)
+	if !ok {
+		return
+	}
+
+	var changed bool
+	var err error
+	if starred {
+		if message.Type == models.MessageTypeSnap {
+			http.Error(w, `{"error": "Snaps cannot be starred"}`, http.StatusBadRequest)
+			return
+		}
+		changed, err = database.StarMessage(message.ID, user.ID)
+	} else {
+		changed, err = database.UnstarMessage(message.ID, user.ID)
+	}
+	if err != nil {
+		http.Error(w, `{"error": "Failed to update star"}`, http.StatusInternalServerError)
+		return
+	}
+
+	// Keep the user's other devices in sync
+	if changed {
+		BroadcastToOtherDevices(user.ID, r.Header.Get("X-Device-ID"), models.WebSocketMessage{
+			Type: "message_starred",
+			Payload: map[string]interface{}{
+				"message_id": message.ID,
+				"starred":    starred,
+			},
+		})
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"message_id": message.ID,
+		"starred":    starred,
+	})
+}
+
+// GetStarredMessages returns the current user's starred messages across all
+// conversations
+func GetStarredMessages(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	limit := 50
+	offset := 0
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 100 {
+			limit = parsed
+		}
+	}
+	if o := r.URL.Query().Get("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+
+	messages, err := database.GetStarredMessages(user.ID, limit, offset)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to get starred messages"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if messages == nil {
+		messages = []models.MessageWithSender{}
+	}
+
+	json.NewEncoder(w).Encode(messages)
+}
@@ -5,8 +5,15 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+
+	"scuffedsnap/database"
+	"scuffedsnap/middleware"
 )
 
+type userSettingsRequest struct {
+	SendReadReceipts *bool `json:"send_read_receipts"`
+}
+
 // GetOnlineUsers returns which of the requested user IDs are currently online
 func GetOnlineUsers(w http.ResponseWriter, r *http.Request) {
 	// Get comma-separated list of user IDs from query param
@@ -38,3 +45,47 @@ func GetOnlineUsers(w http.ResponseWriter, r *http.Request) {
 		"online_users": onlineIDs,
 	})
 }
+
+// GetUserSettings returns the current user's privacy settings
+func GetUserSettings(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"send_read_receipts": user.SendReadReceipts,
+	})
+}
+
+// UpdateUserSettings changes the current user's privacy settings
+func UpdateUserSettings(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := middleware.GetUserFromContext(r)
+	if user == nil {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req userSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.SendReadReceipts != nil {
+		if err := database.SetSendReadReceipts(user.ID, *req.SendReadReceipts); err != nil {
+			http.Error(w, `{"error": "Failed to update settings"}`, http.StatusInternalServerError)
+			return
+		}
+		user.SendReadReceipts = *req.SendReadReceipts
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"send_read_receipts": user.SendReadReceipts,
+	})
+}
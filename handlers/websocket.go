@@ -5,10 +5,13 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 
+	"scuffedsnap/database"
 	"scuffedsnap/middleware"
 	"scuffedsnap/models"
 )
@@ -27,11 +30,20 @@ type Client struct {
 	Conn   *websocket.Conn
 	Send   chan []byte
 	UserID string // Changed to string for Supabase UUID compatibility
+
+	// DeviceID is an optional client-chosen ID (?device_id=) that lets
+	// events skip the device that caused them
+	DeviceID string
+
+	// Authenticated is set for session-authenticated connections. Query
+	// param user IDs are not verified, so only these may send requests.
+	Authenticated bool
 }
 
-// Hub maintains the set of active clients
+// Hub maintains the set of active clients. A user may be connected from
+// several devices at once.
 type Hub struct {
-	clients    map[string]*Client // userID (string) -> client
+	clients    map[string]map[*Client]bool // userID (string) -> connections
 	register   chan *Client
 	unregister chan *Client
 	broadcast  chan BroadcastPayload
@@ -41,10 +53,13 @@ type Hub struct {
 type BroadcastPayload struct {
 	UserID  string
 	Message []byte
+
+	Client       *Client // Only this connection, if set
+	ExceptDevice string  // Skip connections with this DeviceID, if set
 }
 
 var hub = &Hub{
-	clients:    make(map[string]*Client),
+	clients:    make(map[string]map[*Client]bool),
 	register:   make(chan *Client),
 	unregister: make(chan *Client),
 	broadcast:  make(chan BroadcastPayload, 256),
@@ -56,80 +71,159 @@ func RunHub() {
 		select {
 		case client := <-hub.register:
 			hub.mutex.Lock()
-			hub.clients[client.UserID] = client
+			conns := hub.clients[client.UserID]
+			if conns == nil {
+				conns = make(map[*Client]bool)
+				hub.clients[client.UserID] = conns
+			}
+			conns[client] = true
+			first := len(conns) == 1
 			hub.mutex.Unlock()
 			log.Printf("Client connected: UserID %s", client.UserID)
 
 			// Broadcast online status to friends
-			broadcastOnlineStatus(client.UserID, true)
+			if first {
+				broadcastOnlineStatus(client.UserID, true)
+			}
 
 		case client := <-hub.unregister:
 			hub.mutex.Lock()
-			if _, ok := hub.clients[client.UserID]; ok {
-				delete(hub.clients, client.UserID)
-				close(client.Send)
-			}
+			last := removeClient(client)
 			hub.mutex.Unlock()
 			log.Printf("Client disconnected: UserID %s", client.UserID)
 
 			// Broadcast offline status to friends
-			broadcastOnlineStatus(client.UserID, false)
+			if last {
+				broadcastOnlineStatus(client.UserID, false)
+			}
 
 		case payload := <-hub.broadcast:
-			hub.mutex.RLock()
-			if client, ok := hub.clients[payload.UserID]; ok {
+			hub.mutex.Lock()
+			for client := range hub.clients[payload.UserID] {
+				if payload.Client != nil && client != payload.Client {
+					continue
+				}
+				if payload.ExceptDevice != "" && client.DeviceID == payload.ExceptDevice {
+					continue
+				}
 				select {
 				case client.Send <- payload.Message:
 				default:
-					close(client.Send)
-					delete(hub.clients, payload.UserID)
+					removeClient(client)
 				}
 			}
-			hub.mutex.RUnlock()
+			hub.mutex.Unlock()
 		}
 	}
 }
 
+// removeClient drops a connection and closes its send channel. It reports
+// whether that was the user's last connection. The caller holds the lock.
+func removeClient(client *Client) bool {
+	conns, ok := hub.clients[client.UserID]
+	if !ok || !conns[client] {
+		return false
+	}
+	delete(conns, client)
+	close(client.Send)
+	if len(conns) == 0 {
+		delete(hub.clients, client.UserID)
+		forgetBadge(client.UserID)
+		return true
+	}
+	return false
+}
+
 // IsUserOnline checks if a user is currently connected (string version for Supabase UUIDs)
 func IsUserOnline(userID interface{}) bool {
 	hub.mutex.RLock()
 	defer hub.mutex.RUnlock()
 
-	var idStr string
-	switch v := userID.(type) {
-	case string:
-		idStr = v
-	case int64:
-		idStr = fmt.Sprintf("%d", v)
-	default:
-		idStr = fmt.Sprintf("%v", v)
-	}
-
-	_, ok := hub.clients[idStr]
-	return ok
+	return len(hub.clients[userIDString(userID)]) > 0
 }
 
-// BroadcastMessage sends a message to a specific user
+// BroadcastMessage sends a message to every connection of a specific user
 func BroadcastMessage(userID interface{}, msg models.WebSocketMessage) {
+	broadcast(BroadcastPayload{UserID: userIDString(userID)}, msg)
+}
+
+// BroadcastToOtherDevices sends a message to a user's connections except
+// those of deviceID. Without a device ID it reaches every connection.
+func BroadcastToOtherDevices(userID interface{}, deviceID string, msg models.WebSocketMessage) {
+	broadcast(BroadcastPayload{UserID: userIDString(userID), ExceptDevice: deviceID}, msg)
+}
+
+func broadcast(payload BroadcastPayload, msg models.WebSocketMessage) {
 	data, err := json.Marshal(msg)
 	if err != nil {
 		log.Printf("Error marshaling message: %v", err)
 		return
 	}
 
-	var idStr string
+	payload.Message = data
+	hub.broadcast <- payload
+}
+
+func userIDString(userID interface{}) string {
 	switch v := userID.(type) {
 	case string:
-		idStr = v
+		return v
 	case int64:
-		idStr = fmt.Sprintf("%d", v)
+		return fmt.Sprintf("%d", v)
 	default:
-		idStr = fmt.Sprintf("%v", v)
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// BroadcastToAll sends a message to every connected client and returns the
+// user IDs it was delivered to over a session-authenticated connection
+func BroadcastToAll(msg models.WebSocketMessage) []string {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Error marshaling message: %v", err)
+		return nil
+	}
+
+	var delivered []string
+	hub.mutex.RLock()
+	for userID, conns := range hub.clients {
+		sent := false
+		for client := range conns {
+			select {
+			case client.Send <- data:
+				sent = sent || client.Authenticated
+			default:
+			}
+		}
+		if sent {
+			delivered = append(delivered, userID)
+		}
+	}
+	hub.mutex.RUnlock()
+	return delivered
+}
+
+// DisconnectUser closes the live WebSocket connections of a user, sending
+// the reason in the close frame so the client can tell the user why
+func DisconnectUser(userID int64, reason string) {
+	idStr := fmt.Sprintf("%d", userID)
+
+	hub.mutex.RLock()
+	var conns []*Client
+	for client := range hub.clients[idStr] {
+		conns = append(conns, client)
 	}
+	hub.mutex.RUnlock()
+
+	closeMsg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason)
+	for _, client := range conns {
+		client.Conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
 
-	hub.broadcast <- BroadcastPayload{
-		UserID:  idStr,
-		Message: data,
+		// readPump notices the closed connection and unregisters the client
+		client.Conn.Close()
+	}
+	if len(conns) > 0 {
+		log.Printf("Client kicked: UserID %s (%s)", idStr, reason)
 	}
 }
 
@@ -146,8 +240,11 @@ func broadcastOnlineStatus(userID string, online bool) {
 	data, _ := json.Marshal(msg)
 
 	hub.mutex.RLock()
-	for _, client := range hub.clients {
-		if client.UserID != userID {
+	for otherID, conns := range hub.clients {
+		if otherID == userID {
+			continue
+		}
+		for client := range conns {
 			select {
 			case client.Send <- data:
 			default:
@@ -167,6 +264,10 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	if user != nil {
 		// Session-based auth
 		userID = fmt.Sprintf("%d", user.ID)
+	} else if isLocalUserID(r.URL.Query().Get("user_id")) {
+		// Local accounts receive private events, so a bare ID is not enough
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
 	} else {
 		// Supabase auth - get user_id from query param
 		userID = r.URL.Query().Get("user_id")
@@ -184,18 +285,31 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 
 	client := &Client{
-		Conn:   conn,
-		Send:   make(chan []byte, 256),
-		UserID: userID,
+		Conn:          conn,
+		Send:          make(chan []byte, 256),
+		UserID:        userID,
+		DeviceID:      r.URL.Query().Get("device_id"),
+		Authenticated: user != nil,
 	}
 
 	hub.register <- client
 
+	// Catch the user up on announcements made while they were away
+	go deliverPendingAnnouncements(client)
+
 	// Start goroutines for reading and writing
 	go client.writePump()
 	go client.readPump()
 }
 
+// isLocalUserID reports whether a query-param user ID names a local
+// account, which has to connect with its session instead. Supabase UUIDs
+// are not local users and pass through.
+func isLocalUserID(userID string) bool {
+	_, err := strconv.ParseInt(userID, 10, 64)
+	return err == nil
+}
+
 func (c *Client) readPump() {
 	defer func() {
 		hub.unregister <- c
@@ -211,7 +325,7 @@ func (c *Client) readPump() {
 			break
 		}
 
-		// Handle incoming messages (typing indicators, etc.)
+		// Handle incoming messages (typing indicators, requests, etc.)
 		var wsMsg models.WebSocketMessage
 		if err := json.Unmarshal(message, &wsMsg); err != nil {
 			continue
@@ -231,8 +345,62 @@ func (c *Client) readPump() {
 					})
 				}
 			}
+
+		case "ack":
+			// The client confirms it received messages
+			if payload, ok := wsMsg.Payload.(map[string]interface{}); ok {
+				c.acknowledgeDelivery(payload["message_ids"])
+			}
+
+		case "send_message", "mark_read", "fetch_history":
+			// Requests get an ack or error carrying their request_id
+			c.handleRequest(message)
+
+		case "screenshot":
+			// The client saw the user screenshot a snap
+			if payload, ok := wsMsg.Payload.(map[string]interface{}); ok {
+				c.relaySnapScreenshot(payload["message_id"])
+			}
+		}
+	}
+}
+
+// acknowledgeDelivery marks acknowledged messages as delivered and sends
+// delivery receipts to their senders
+func (c *Client) acknowledgeDelivery(rawIDs interface{}) {
+	receiverID, err := strconv.ParseInt(c.UserID, 10, 64)
+	if err != nil || database.DB == nil || !c.Authenticated {
+		return
+	}
+
+	list, ok := rawIDs.([]interface{})
+	if !ok || len(list) == 0 {
+		return
+	}
+
+	var messageIDs []int64
+	for _, raw := range list {
+		if id, ok := raw.(float64); ok {
+			messageIDs = append(messageIDs, int64(id))
 		}
 	}
+
+	bySender, err := database.MarkMessagesDelivered(messageIDs, receiverID)
+	if err != nil {
+		log.Printf("Failed to mark messages delivered: %v", err)
+		return
+	}
+
+	for senderID, ids := range bySender {
+		BroadcastMessage(senderID, models.WebSocketMessage{
+			Type: "receipts",
+			Payload: map[string]interface{}{
+				"status":      models.MessageStatusDelivered,
+				"user_id":     receiverID,
+				"message_ids": ids,
+			},
+		})
+	}
 }
 
 func (c *Client) writePump() {
@@ -6,7 +6,10 @@ import (
 	"net/http"
 	"os"
 
+	"scuffedsnap/database"
 	"scuffedsnap/handlers"
+	"scuffedsnap/middleware"
+	"scuffedsnap/pkg/filter"
 	"scuffedsnap/pkg/push"
 
 	"github.com/joho/godotenv"
@@ -18,6 +21,15 @@ func main() {
 		log.Println("⚠️  No .env file found, using environment variables")
 	}
 
+	// Anything but "serve" is an admin subcommand that runs against the
+	// database and exits; unknown commands print the usage
+	if len(os.Args) > 1 && os.Args[1] != "serve" {
+		if err := runCLI(os.Args[1:]); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		return
+	}
+
 	// Get port from environment or use default
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -27,6 +39,9 @@ func main() {
 	// Initialize Push Service
 	push.InitPush()
 
+	// Load content filter rules for outgoing messages
+	filter.InitFilter()
+
 	// Static files
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("./static"))))
 
@@ -67,8 +82,31 @@ func main() {
 		http.ServeFile(w, r, "./static/admin.html")
 	})
 
-	// WebSocket endpoint for real-time features
-	http.HandleFunc("/ws", handlers.HandleWebSocket)
+	// Session-authenticated API backed by our own Postgres (optional)
+	if os.Getenv("DATABASE_URL") != "" {
+		if err := database.Initialize(); err != nil {
+			log.Fatalf("Database init failed: %v", err)
+		}
+		http.Handle("/api/", handlers.NewAPIRouter())
+
+		// Pushes address local user IDs, so read subscriptions from our database
+		push.SetSubscriptionStore(handlers.PushSubscriptionStore{})
+
+		// Wipe viewed and timed out snaps
+		go handlers.RunSnapJanitor()
+
+		// Delete disappearing messages once they expire
+		go handlers.RunExpiryJanitor()
+
+		// Send scheduled messages when they come due
+		go handlers.RunMessageScheduler()
+
+		// WebSocket endpoint for real-time features
+		http.Handle("/ws", middleware.OptionalAuth(http.HandlerFunc(handlers.HandleWebSocket)))
+	} else {
+		// WebSocket endpoint for real-time features
+		http.HandleFunc("/ws", handlers.HandleWebSocket)
+	}
 
 	// Start WebSocket hub in background
 	go handlers.RunHub()
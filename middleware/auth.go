@@ -33,6 +33,13 @@ func Auth(next http.Handler) http.Handler {
 			return
 		}
 
+		// Disabled accounts lose access even if a session slipped through
+		if user.IsDisabled {
+			database.DeleteUserSessions(user.ID)
+			http.Error(w, `{"error": "Account disabled"}`, http.StatusForbidden)
+			return
+		}
+
 		ctx := context.WithValue(r.Context(), UserContextKey, user)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -63,7 +70,7 @@ func OptionalAuth(next http.Handler) http.Handler {
 		}
 
 		user, err := database.GetUserByID(session.UserID)
-		if err != nil {
+		if err != nil || user.IsDisabled {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -72,3 +79,22 @@ func OptionalAuth(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// Admin middleware rejects authenticated users who are not admins.
+// It must be chained after Auth.
+func Admin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := GetUserFromContext(r)
+		if user == nil {
+			http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+
+		if !user.IsAdmin {
+			http.Error(w, `{"error": "Admin access required"}`, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// AnnouncementSeverity controls how prominently clients show an announcement
+type AnnouncementSeverity string
+
+const (
+	AnnouncementInfo     AnnouncementSeverity = "info"
+	AnnouncementWarning  AnnouncementSeverity = "warning"
+	AnnouncementCritical AnnouncementSeverity = "critical"
+)
+
+// Announcement is a system-wide message from an admin to every user
+type Announcement struct {
+	ID        int64                `json:"id"`
+	AuthorID  *int64               `json:"author_id,omitempty"`
+	Severity  AnnouncementSeverity `json:"severity"`
+	Text      string               `json:"text"`
+	ExpiresAt *time.Time           `json:"expires_at,omitempty"`
+	CreatedAt time.Time            `json:"created_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// AuditLogEntry records an administrative action for later review
+type AuditLogEntry struct {
+	ID           int64     `json:"id"`
+	ActorID      *int64    `json:"actor_id,omitempty"` // nil for actions run outside a user session
+	Action       string    `json:"action"`
+	TargetUserID *int64    `json:"target_user_id,omitempty"`
+	Details      string    `json:"details,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
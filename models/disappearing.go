@@ -0,0 +1,80 @@
+package models
+
+import "time"
+
+// MessageTypeSystem is the type of notices the server posts into a
+// conversation, such as disappearing timer changes
+const MessageTypeSystem = "system"
+
+// Disappearing message timers a conversation can use
+const (
+	DisappearingOff          = "off"
+	Disappearing30sAfterRead = "30s_after_read"
+	Disappearing1h           = "1h"
+	Disappearing24h          = "24h"
+	Disappearing7d           = "7d"
+)
+
+type disappearingRule struct {
+	seconds   int
+	afterRead bool
+	label     string
+}
+
+var disappearingRules = map[string]disappearingRule{
+	Disappearing30sAfterRead: {30, true, "30 seconds after reading"},
+	Disappearing1h:           {60 * 60, false, "1 hour"},
+	Disappearing24h:          {24 * 60 * 60, false, "24 hours"},
+	Disappearing7d:           {7 * 24 * 60 * 60, false, "7 days"},
+}
+
+// DisappearingTimer is the disappearing message setting both participants
+// of a conversation share. New messages expire Seconds after they are sent,
+// or after they are read if AfterRead is set.
+type DisappearingTimer struct {
+	Timer     string                `json:"timer"`
+	Seconds   int                   `json:"seconds,omitempty"`
+	AfterRead bool                  `json:"after_read"`
+	UpdatedBy *int64                `json:"updated_by,omitempty"`
+	UpdatedAt *time.Time            `json:"updated_at,omitempty"`
+	Pending   *DisappearingProposal `json:"pending,omitempty"` // Waiting for the other participant
+}
+
+// DisappearingProposal is a timer one participant asked for that only
+// applies once the other accepts it
+type DisappearingProposal struct {
+	DisappearingTimer
+	ProposedBy int64     `json:"proposed_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// NewDisappearingTimer returns the timer called name, or false if there is
+// no such timer
+func NewDisappearingTimer(name string) (*DisappearingTimer, bool) {
+	if name == DisappearingOff {
+		return &DisappearingTimer{Timer: DisappearingOff}, true
+	}
+	rule, ok := disappearingRules[name]
+	if !ok {
+		return nil, false
+	}
+	return &DisappearingTimer{Timer: name, Seconds: rule.seconds, AfterRead: rule.afterRead}, true
+}
+
+// SetName fills in Timer from Seconds and AfterRead
+func (t *DisappearingTimer) SetName() {
+	t.Timer = DisappearingOff
+	for name, rule := range disappearingRules {
+		if rule.seconds == t.Seconds && rule.afterRead == t.AfterRead {
+			t.Timer = name
+		}
+	}
+}
+
+// Label describes the timer for people, e.g. "24 hours"
+func (t *DisappearingTimer) Label() string {
+	if rule, ok := disappearingRules[t.Timer]; ok {
+		return rule.label
+	}
+	return "off"
+}
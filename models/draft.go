@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// Draft is an unsent message a user is composing in a conversation. It is
+// synced between devices; the newest UpdatedAt wins.
+type Draft struct {
+	OtherUserID int64     `json:"other_user_id"`
+	Content     string    `json:"content"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
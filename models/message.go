@@ -12,13 +12,168 @@ type Message struct {
 	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
 	ReadAt     *time.Time `json:"read_at,omitempty"`
 	CreatedAt  time.Time  `json:"created_at"`
+
+	ExpireAfterRead *int `json:"expire_after_read,omitempty"` // Seconds the message lives once read
+
+	DeliveredAt *time.Time    `json:"delivered_at,omitempty"`
+	Status      MessageStatus `json:"status"`
+
+	Edited    bool       `json:"edited"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` // Set on tombstones of unsent messages
+
+	RepliedToMessageID *int64  `json:"replied_to_message_id,omitempty"`
+	ReplyCount         int     `json:"reply_count"`
+	Mentions           []int64 `json:"mentions,omitempty"` // IDs of @mentioned users
+	Pinned             bool    `json:"pinned"`
+
+	Format        string       `json:"format"`                 // "plain" or "markdown"
+	ContentHTML   string       `json:"content_html,omitempty"` // Sanitized rendering of markdown content
+	LinkPreview   *LinkPreview `json:"link_preview,omitempty"`
+	ForwardedFrom *ForwardInfo `json:"forwarded_from,omitempty"`
+	ClientMsgID   string       `json:"client_msg_id,omitempty"` // Echoed so senders can match optimistic sends
+	Poll          *Poll        `json:"poll,omitempty"`          // Only set for polls
+
+	Snap *SnapInfo `json:"snap,omitempty"` // Only set for snaps
+}
+
+// ForwardInfo records where a forwarded message originally came from. For
+// forwards of forwards it points at the first message in the chain.
+type ForwardInfo struct {
+	MessageID  *int64 `json:"message_id,omitempty"` // Unset once the original is gone
+	SenderID   int64  `json:"sender_id"`            // Original author
+	ReceiverID int64  `json:"receiver_id"`          // The other participant of the original conversation
+}
+
+// LinkPreview is the page metadata shown under a message containing a link
+type LinkPreview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"image_url,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+}
+
+// Message content formats
+const (
+	MessageFormatPlain    = "plain"
+	MessageFormatMarkdown = "markdown"
+)
+
+// MessageTypeSnap is the type of view-once media messages
+const MessageTypeSnap = "snap"
+
+// Snap view states
+const (
+	SnapStatusUnopened = "unopened"
+	SnapStatusOpened   = "opened"
+	SnapStatusExpired  = "expired"
+)
+
+// SnapInfo tracks how a view-once snap has been viewed
+type SnapInfo struct {
+	MaxViews  int        `json:"max_views"`
+	ViewCount int        `json:"view_count"`
+	OpenedAt  *time.Time `json:"opened_at,omitempty"`
+	Status    string     `json:"status"`
+}
+
+// UpdateStatus derives Status from the view counters. purgedAt is when the
+// snap's media was deleted, if it has been.
+func (s *SnapInfo) UpdateStatus(purgedAt *time.Time) {
+	switch {
+	case s.ViewCount > 0:
+		s.Status = SnapStatusOpened
+	case purgedAt != nil:
+		s.Status = SnapStatusExpired
+	default:
+		s.Status = SnapStatusUnopened
+	}
+}
+
+// HideSnapContent blanks a snap's media so it can only be fetched through
+// the open endpoint
+func (m *Message) HideSnapContent() {
+	if m.Type == MessageTypeSnap {
+		m.Content = ""
+		m.ContentHTML = ""
+	}
+}
+
+// MessageStatus is the delivery state of a message as seen by its sender
+type MessageStatus string
+
+const (
+	MessageStatusSent      MessageStatus = "sent"
+	MessageStatusDelivered MessageStatus = "delivered"
+	MessageStatusRead      MessageStatus = "read"
+)
+
+// UpdateStatus derives Status from the delivery timestamps
+func (m *Message) UpdateStatus() {
+	switch {
+	case m.ReadAt != nil:
+		m.Status = MessageStatusRead
+	case m.DeliveredAt != nil:
+		m.Status = MessageStatusDelivered
+	default:
+		m.Status = MessageStatusSent
+	}
+}
+
+// RedactReadReceipt removes read information from viewerID's copy of a
+// message they sent to a receiver who opted out of sending read receipts.
+// An expiry started by reading would give the read time away, so it is
+// dropped too.
+func (m *Message) RedactReadReceipt(viewerID int64, receiverSendsReceipts bool) {
+	if receiverSendsReceipts || m.SenderID != viewerID || m.ReceiverID == viewerID {
+		return
+	}
+	if m.ReadAt != nil && m.ExpireAfterRead != nil {
+		m.ExpiresAt = nil
+	}
+	m.ReadAt = nil
+	m.UpdateStatus()
 }
 
 // MessageWithSender includes sender info for display
 type MessageWithSender struct {
 	Message
+	SenderUsername string            `json:"sender_username"`
+	SenderAvatar   string            `json:"sender_avatar"`
+	ReplyTo        *MessagePreview   `json:"reply_to,omitempty"`
+	Reactions      []ReactionSummary `json:"reactions,omitempty"`
+}
+
+// ReactionSummary aggregates one emoji's reactions on a message
+type ReactionSummary struct {
+	Emoji       string `json:"emoji"`
+	Count       int    `json:"count"`
+	ReactedByMe bool   `json:"reacted_by_me"`
+}
+
+// MessagePreview is a short summary of the message being replied to
+type MessagePreview struct {
+	ID             int64  `json:"id"`
+	SenderID       int64  `json:"sender_id"`
 	SenderUsername string `json:"sender_username"`
-	SenderAvatar   string `json:"sender_avatar"`
+	Content        string `json:"content"` // Truncated
+	Type           string `json:"type"`
+	Deleted        bool   `json:"deleted"` // Unsent, expired or hidden; only ID is set
+}
+
+// Tombstone strips a preview down to its ID for a parent the viewer can
+// no longer see
+func (p *MessagePreview) Tombstone() {
+	*p = MessagePreview{ID: p.ID, Deleted: true}
+}
+
+// MessageRevision is a previous version of an edited message
+type MessageRevision struct {
+	ID        int64     `json:"id"`
+	MessageID int64     `json:"message_id"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"` // When this version was replaced
 }
 
 // Conversation represents a chat thread with another user
@@ -26,10 +181,35 @@ type Conversation struct {
 	User        UserResponse `json:"user"`
 	LastMessage *Message     `json:"last_message,omitempty"`
 	UnreadCount int          `json:"unread_count"`
+
+	ReadWatermark int64 `json:"read_watermark,omitempty"` // Newest of our messages the other user has read
+
+	DisappearingTimer string `json:"disappearing_timer"` // Shared by both participants
+
+	ConversationSettings
+}
+
+// ConversationSettings is one user's private state for a conversation
+type ConversationSettings struct {
+	Muted        bool       `json:"muted"`
+	MutedUntil   *time.Time `json:"muted_until,omitempty"` // Unset while muted means indefinitely
+	Archived     bool       `json:"archived"`
+	KeepArchived bool       `json:"keep_archived"` // Stay archived when new messages arrive
+	PinnedAt     *time.Time `json:"pinned_at,omitempty"`
 }
 
 // WebSocketMessage is the format for real-time messages
 type WebSocketMessage struct {
-	Type    string      `json:"type"` // "message", "typing", "read", "online"
-	Payload interface{} `json:"payload"`
+	Type      string      `json:"type"`                 // "message", "typing", "read", "online"
+	RequestID string      `json:"request_id,omitempty"` // Correlates socket requests with their ack or error
+	Payload   interface{} `json:"payload"`
+}
+
+// BadgeCounts summarizes what is waiting for a user, for app badges
+type BadgeCounts struct {
+	UnreadMessages      int `json:"unread_messages"`
+	UnreadConversations int `json:"unread_conversations"`
+	FriendRequests      int `json:"friend_requests"` // Pending requests to the user
+	UnreadMentions      int `json:"unread_mentions"`
+	Total               int `json:"total"` // Unread messages plus friend requests
 }
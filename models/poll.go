@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// MessageTypePoll is the type of poll messages; the content is the question
+const MessageTypePoll = "poll"
+
+// Poll is the state of a poll message from one user's point of view
+type Poll struct {
+	MultipleChoice bool         `json:"multiple_choice"`
+	Anonymous      bool         `json:"anonymous"` // Voter IDs are hidden
+	ClosesAt       *time.Time   `json:"closes_at,omitempty"`
+	Closed         bool         `json:"closed"`
+	TotalVoters    int          `json:"total_voters"`
+	Options        []PollOption `json:"options"`
+}
+
+// PollOption is one answer of a poll with its tally
+type PollOption struct {
+	ID        int64   `json:"id"`
+	Text      string  `json:"text"`
+	Votes     int     `json:"votes"`
+	VotedByMe bool    `json:"voted_by_me"`
+	Voters    []int64 `json:"voters,omitempty"` // Only for named polls
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// PushSubscription is a browser's Web Push endpoint for one user
+type PushSubscription struct {
+	UserID    int64     `json:"user_id"`
+	Endpoint  string    `json:"endpoint"`
+	P256dh    string    `json:"p256dh"`
+	Auth      string    `json:"auth"`
+	CreatedAt time.Time `json:"created_at"`
+}
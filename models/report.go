@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// ReportStatus represents where a report is in the moderation queue
+type ReportStatus string
+
+const (
+	ReportStatusOpen      ReportStatus = "open"
+	ReportStatusActioned  ReportStatus = "actioned"
+	ReportStatusDismissed ReportStatus = "dismissed"
+)
+
+// Moderation actions a moderator can take when resolving a report
+const (
+	ReportActionDeleteMessage = "delete_message"
+	ReportActionWarn          = "warn"
+	ReportActionDisableUser   = "disable_user"
+	ReportActionDismiss       = "dismiss"
+)
+
+// Report is a user complaint about a message or another user.
+// The message fields are a snapshot taken when the report was filed so
+// moderators can still see what was said after the message is gone.
+type Report struct {
+	ID               int64        `json:"id"`
+	ReporterID       int64        `json:"reporter_id"`
+	ReportedUserID   int64        `json:"reported_user_id"`
+	MessageID        *int64       `json:"message_id,omitempty"`
+	MessageContent   string       `json:"message_content,omitempty"`
+	MessageType      string       `json:"message_type,omitempty"`
+	MessageCreatedAt *time.Time   `json:"message_created_at,omitempty"`
+	Reason           string       `json:"reason"`
+	Status           ReportStatus `json:"status"`
+	Action           string       `json:"action,omitempty"`
+	ModeratorNote    string       `json:"moderator_note,omitempty"`
+	ResolvedBy       *int64       `json:"resolved_by,omitempty"`
+	ResolvedAt       *time.Time   `json:"resolved_at,omitempty"`
+	CreatedAt        time.Time    `json:"created_at"`
+}
+
+// HideModeration clears what only moderators should see before a report is
+// shown to the user who filed it
+func (r *Report) HideModeration() {
+	r.ModeratorNote = ""
+	r.ResolvedBy = nil
+}
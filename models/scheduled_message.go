@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// ScheduledMessage is a message waiting to be sent at SendAt. Once sent it
+// becomes a regular Message and the scheduled entry is removed.
+type ScheduledMessage struct {
+	ID                 int64     `json:"id"`
+	SenderID           int64     `json:"sender_id"`
+	ReceiverID         int64     `json:"receiver_id"`
+	Content            string    `json:"content"`
+	Type               string    `json:"type"`
+	Format             string    `json:"format"`
+	ContentHTML        string    `json:"content_html,omitempty"`
+	RepliedToMessageID *int64    `json:"replied_to_message_id,omitempty"`
+	MaxViews           int       `json:"max_views"`
+	ExpireSeconds      *int64    `json:"expire_seconds,omitempty"` // Lifetime of the sent message, if it disappears
+	SendAt             time.Time `json:"send_at"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+	ClientMsgID        string    `json:"client_msg_id,omitempty"` // Deduplicates retries while pending
+}
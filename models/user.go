@@ -11,7 +11,10 @@ type User struct {
 	Avatar     string    `json:"avatar"`
 	AuthMethod string    `json:"auth_method"`
 	IsDisabled bool      `json:"is_disabled"`
+	IsAdmin    bool      `json:"is_admin"`
 	CreatedAt  time.Time `json:"created_at"`
+
+	SendReadReceipts bool `json:"send_read_receipts"` // Privacy: let senders see when we read
 }
 
 // UserResponse is the safe version of User for API responses
@@ -22,6 +25,7 @@ type UserResponse struct {
 	Avatar     string    `json:"avatar"`
 	AuthMethod string    `json:"auth_method"`
 	IsDisabled bool      `json:"is_disabled"`
+	IsAdmin    bool      `json:"is_admin"`
 	CreatedAt  time.Time `json:"created_at"`
 	Online     bool      `json:"online"`
 }
@@ -35,6 +39,7 @@ func (u *User) ToResponse() UserResponse {
 		Avatar:     u.Avatar,
 		AuthMethod: u.AuthMethod,
 		IsDisabled: u.IsDisabled,
+		IsAdmin:    u.IsAdmin,
 		CreatedAt:  u.CreatedAt,
 		Online:     false,
 	}
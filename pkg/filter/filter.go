@@ -0,0 +1,307 @@
+package filter
+
+import (
+	"encoding/json"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Action is what happens to a message that matches a rule
+type Action string
+
+const (
+	ActionReject Action = "reject" // Refuse to store the message
+	ActionMask   Action = "mask"   // Replace the matched text with asterisks
+	ActionFlag   Action = "flag"   // Store as-is but report it for moderation
+)
+
+// RuleConfig is a word or regex blocklist entry in the config file
+type RuleConfig struct {
+	Name     string   `json:"name"`
+	Words    []string `json:"words"`    // Matched case-insensitively on word boundaries
+	Patterns []string `json:"patterns"` // Go regular expressions
+	Action   Action   `json:"action"`
+}
+
+// LinkConfig restricts which domains may be linked. Subdomains match their
+// parent, so "example.com" also covers "www.example.com".
+type LinkConfig struct {
+	Allow  []string `json:"allow"` // If set, only these domains are permitted
+	Deny   []string `json:"deny"`
+	Action Action   `json:"action"`
+}
+
+// Override replaces or extends the global settings for one conversation
+type Override struct {
+	Disabled bool         `json:"disabled"`
+	DryRun   *bool        `json:"dry_run,omitempty"`
+	Rules    []RuleConfig `json:"rules"` // Applied in addition to the global rules
+	Links    *LinkConfig  `json:"links,omitempty"`
+}
+
+// Config is the content filter configuration file format
+type Config struct {
+	DryRun        bool                `json:"dry_run"` // Only log what would have happened
+	Rules         []RuleConfig        `json:"rules"`
+	Links         LinkConfig          `json:"links"`
+	Conversations map[string]Override `json:"conversations"` // Keyed by "<user id>:<user id>", in either order
+}
+
+// Result describes what the filter chain did to a message
+type Result struct {
+	Content  string   // Content to store, possibly masked
+	Rejected bool     // The message must not be stored
+	Flagged  bool     // The message should be sent to moderation
+	Matches  []string // Names of the rules that matched
+}
+
+type rule struct {
+	name    string
+	pattern *regexp.Regexp
+	action  Action
+}
+
+type override struct {
+	Override
+	rules []rule
+}
+
+var (
+	mu        sync.RWMutex
+	config    Config
+	rules     []rule
+	overrides = make(map[string]override) // Keyed by conversationKey
+)
+
+var urlPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"']+`)
+
+// InitFilter loads the filter config from CONTENT_FILTER_CONFIG, falling back
+// to content_filter.json. With no config every message passes untouched.
+func InitFilter() {
+	path := os.Getenv("CONTENT_FILTER_CONFIG")
+	if path == "" {
+		path = "content_filter.json"
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		log.Println("⚠️  No content filter config found, filtering disabled")
+		return
+	}
+	defer file.Close()
+
+	var cfg Config
+	if err := json.NewDecoder(file).Decode(&cfg); err != nil {
+		log.Printf("⚠️  Invalid content filter config %s: %v", path, err)
+		return
+	}
+
+	SetConfig(cfg)
+	log.Printf("✅ Loaded content filter config from %s", path)
+}
+
+// SetConfig replaces the active configuration
+func SetConfig(cfg Config) {
+	compiled := compileRules(cfg.Rules)
+
+	compiledOverrides := make(map[string]override)
+	for key, o := range cfg.Conversations {
+		normalized, ok := parseConversationKey(key)
+		if !ok {
+			log.Printf("⚠️  Skipping content filter override for invalid conversation %q", key)
+			continue
+		}
+		compiledOverrides[normalized] = override{Override: o, rules: compileRules(o.Rules)}
+	}
+
+	mu.Lock()
+	config = cfg
+	rules = compiled
+	overrides = compiledOverrides
+	mu.Unlock()
+}
+
+// conversationKey identifies the direct conversation between two users the
+// same way whichever of them is sending
+func conversationKey(userID, otherUserID int64) string {
+	if userID > otherUserID {
+		userID, otherUserID = otherUserID, userID
+	}
+	return strconv.FormatInt(userID, 10) + ":" + strconv.FormatInt(otherUserID, 10)
+}
+
+// parseConversationKey turns a config key such as "42:7" into its
+// conversationKey
+func parseConversationKey(key string) (string, bool) {
+	a, b, found := strings.Cut(key, ":")
+	if !found {
+		return "", false
+	}
+	userID, err := strconv.ParseInt(strings.TrimSpace(a), 10, 64)
+	if err != nil {
+		return "", false
+	}
+	otherUserID, err := strconv.ParseInt(strings.TrimSpace(b), 10, 64)
+	if err != nil {
+		return "", false
+	}
+	return conversationKey(userID, otherUserID), true
+}
+
+func compileRules(configs []RuleConfig) []rule {
+	var compiled []rule
+	for _, rc := range configs {
+		action := rc.Action
+		if action == "" {
+			action = ActionReject
+		}
+
+		if len(rc.Words) > 0 {
+			quoted := make([]string, 0, len(rc.Words))
+			for _, w := range rc.Words {
+				if w = strings.TrimSpace(w); w != "" {
+					quoted = append(quoted, regexp.QuoteMeta(w))
+				}
+			}
+			if len(quoted) > 0 {
+				re := regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+				compiled = append(compiled, rule{name: rc.Name, pattern: re, action: action})
+			}
+		}
+
+		for _, p := range rc.Patterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				log.Printf("⚠️  Skipping invalid filter pattern %q in rule %q: %v", p, rc.Name, err)
+				continue
+			}
+			compiled = append(compiled, rule{name: rc.Name, pattern: re, action: action})
+		}
+	}
+	return compiled
+}
+
+// Check runs content sent between senderID and receiverID through the
+// filter chain, applying the conversation's override if it has one
+func Check(content string, senderID, receiverID int64) Result {
+	mu.RLock()
+	chain := rules
+	links := config.Links
+	dryRun := config.DryRun
+	o, hasOverride := overrides[conversationKey(senderID, receiverID)]
+	mu.RUnlock()
+
+	result := Result{Content: content}
+
+	if hasOverride {
+		if o.Disabled {
+			return result
+		}
+		if len(o.rules) > 0 {
+			chain = append(append([]rule{}, chain...), o.rules...)
+		}
+		if o.DryRun != nil {
+			dryRun = *o.DryRun
+		}
+		if o.Links != nil {
+			links = *o.Links
+		}
+	}
+
+	masked := content
+	for _, r := range chain {
+		if !r.pattern.MatchString(masked) {
+			continue
+		}
+		result.Matches = append(result.Matches, r.name)
+		switch r.action {
+		case ActionReject:
+			result.Rejected = true
+		case ActionFlag:
+			result.Flagged = true
+		case ActionMask:
+			masked = r.pattern.ReplaceAllStringFunc(masked, maskText)
+		}
+	}
+
+	if checkLinks(masked, links) {
+		result.Matches = append(result.Matches, "links")
+		switch links.Action {
+		case ActionFlag:
+			result.Flagged = true
+		case ActionMask:
+			masked = urlPattern.ReplaceAllStringFunc(masked, func(u string) string {
+				if linkBlocked(u, links) {
+					return maskText(u)
+				}
+				return u
+			})
+		default:
+			result.Rejected = true
+		}
+	}
+
+	if dryRun {
+		if len(result.Matches) > 0 {
+			log.Printf("Content filter (dry run): matched %v, rejected=%v flagged=%v", result.Matches, result.Rejected, result.Flagged)
+		}
+		return Result{Content: content, Matches: result.Matches}
+	}
+
+	result.Content = masked
+	return result
+}
+
+// checkLinks reports whether content links to any blocked domain
+func checkLinks(content string, links LinkConfig) bool {
+	if len(links.Allow) == 0 && len(links.Deny) == 0 {
+		return false
+	}
+	for _, u := range urlPattern.FindAllString(content, -1) {
+		if linkBlocked(u, links) {
+			return true
+		}
+	}
+	return false
+}
+
+func linkBlocked(rawURL string, links LinkConfig) bool {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return true
+	}
+	host := strings.ToLower(parsed.Hostname())
+
+	for _, d := range links.Deny {
+		if domainMatches(host, d) {
+			return true
+		}
+	}
+	if len(links.Allow) == 0 {
+		return false
+	}
+	for _, d := range links.Allow {
+		if domainMatches(host, d) {
+			return false
+		}
+	}
+	return true
+}
+
+func domainMatches(host, domain string) bool {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+func maskText(s string) string {
+	return strings.Repeat("*", utf8.RuneCountInString(s))
+}
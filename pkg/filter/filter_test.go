@@ -0,0 +1,222 @@
+package filter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	rulesOnly := Config{
+		Rules: []RuleConfig{
+			{Name: "slurs", Words: []string{"badword"}, Action: ActionReject},
+			{Name: "phone", Patterns: []string{`\b\d{3}-\d{3}-\d{4}\b`}, Action: ActionMask},
+			{Name: "spam", Words: []string{"free money"}, Action: ActionFlag},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		config   Config
+		content  string
+		want     string
+		rejected bool
+		flagged  bool
+		matches  []string
+	}{
+		{
+			name:    "no match passes through",
+			config:  rulesOnly,
+			content: "hello there",
+			want:    "hello there",
+		},
+		{
+			name:     "reject word case-insensitively",
+			config:   rulesOnly,
+			content:  "you BadWord",
+			want:     "you BadWord",
+			rejected: true,
+			matches:  []string{"slurs"},
+		},
+		{
+			name:    "word rule respects word boundaries",
+			config:  rulesOnly,
+			content: "badwords are fine",
+			want:    "badwords are fine",
+		},
+		{
+			name:    "mask pattern",
+			config:  rulesOnly,
+			content: "call 555-123-4567 now",
+			want:    "call ************ now",
+			matches: []string{"phone"},
+		},
+		{
+			name:    "flag keeps content",
+			config:  rulesOnly,
+			content: "get free money here",
+			want:    "get free money here",
+			flagged: true,
+			matches: []string{"spam"},
+		},
+		{
+			name:     "multiple rules combine",
+			config:   rulesOnly,
+			content:  "badword 555-123-4567 free money",
+			want:     "badword ************ free money",
+			rejected: true,
+			flagged:  true,
+			matches:  []string{"slurs", "phone", "spam"},
+		},
+		{
+			name: "dry run only reports matches",
+			config: Config{
+				DryRun: true,
+				Rules:  rulesOnly.Rules,
+			},
+			content: "badword 555-123-4567",
+			want:    "badword 555-123-4567",
+			matches: []string{"slurs", "phone"},
+		},
+		{
+			name: "denied domain rejected by default",
+			config: Config{
+				Links: LinkConfig{Deny: []string{"grabify.link"}},
+			},
+			content:  "look https://grabify.link/abc",
+			want:     "look https://grabify.link/abc",
+			rejected: true,
+			matches:  []string{"links"},
+		},
+		{
+			name: "denied subdomain",
+			config: Config{
+				Links: LinkConfig{Deny: []string{"grabify.link"}, Action: ActionFlag},
+			},
+			content: "www.cdn.grabify.link/x",
+			want:    "www.cdn.grabify.link/x",
+			flagged: true,
+			matches: []string{"links"},
+		},
+		{
+			name: "deny does not match lookalike domain",
+			config: Config{
+				Links: LinkConfig{Deny: []string{"grabify.link"}},
+			},
+			content: "https://notgrabify.link",
+			want:    "https://notgrabify.link",
+		},
+		{
+			name: "allow list permits listed domain",
+			config: Config{
+				Links: LinkConfig{Allow: []string{"example.com"}},
+			},
+			content: "see https://www.example.com/page",
+			want:    "see https://www.example.com/page",
+		},
+		{
+			name: "allow list masks only unlisted links",
+			config: Config{
+				Links: LinkConfig{Allow: []string{"example.com"}, Action: ActionMask},
+			},
+			content: "https://example.com and http://evil.io",
+			want:    "https://example.com and **************",
+			matches: []string{"links"},
+		},
+		{
+			name: "deny wins over allow",
+			config: Config{
+				Links: LinkConfig{Allow: []string{"example.com"}, Deny: []string{"bad.example.com"}},
+			},
+			content:  "https://bad.example.com",
+			want:     "https://bad.example.com",
+			rejected: true,
+			matches:  []string{"links"},
+		},
+		{
+			name: "dry run link deny",
+			config: Config{
+				DryRun: true,
+				Links:  LinkConfig{Deny: []string{"grabify.link"}, Action: ActionMask},
+			},
+			content: "https://grabify.link",
+			want:    "https://grabify.link",
+			matches: []string{"links"},
+		},
+	}
+
+	defer SetConfig(Config{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetConfig(tt.config)
+			got := Check(tt.content, 1, 2)
+			if got.Content != tt.want {
+				t.Errorf("Content = %q, want %q", got.Content, tt.want)
+			}
+			if got.Rejected != tt.rejected {
+				t.Errorf("Rejected = %v, want %v", got.Rejected, tt.rejected)
+			}
+			if got.Flagged != tt.flagged {
+				t.Errorf("Flagged = %v, want %v", got.Flagged, tt.flagged)
+			}
+			if !reflect.DeepEqual(got.Matches, tt.matches) {
+				t.Errorf("Matches = %v, want %v", got.Matches, tt.matches)
+			}
+		})
+	}
+}
+
+func TestInvalidPatternSkipped(t *testing.T) {
+	defer SetConfig(Config{})
+	SetConfig(Config{Rules: []RuleConfig{
+		{Name: "broken", Patterns: []string{"("}},
+		{Name: "ok", Patterns: []string{"secret"}},
+	}})
+
+	got := Check("a secret", 1, 2)
+	if !got.Rejected || !reflect.DeepEqual(got.Matches, []string{"ok"}) {
+		t.Errorf("Check = %+v, want rejection by ok only", got)
+	}
+}
+
+func TestConversationOverride(t *testing.T) {
+	dryRun := true
+	defer SetConfig(Config{})
+	SetConfig(Config{
+		Rules: []RuleConfig{{Name: "slurs", Words: []string{"badword"}}},
+		Conversations: map[string]Override{
+			"2:1":  {Rules: []RuleConfig{{Name: "extra", Words: []string{"spoiler"}, Action: ActionMask}}},
+			"3:4":  {Disabled: true},
+			"5:6":  {DryRun: &dryRun},
+			"7:8":  {Links: &LinkConfig{Deny: []string{"example.com"}, Action: ActionFlag}},
+			"nope": {Disabled: true},
+		},
+	})
+
+	tests := []struct {
+		name     string
+		content  string
+		sender   int64
+		receiver int64
+		want     string
+		rejected bool
+		flagged  bool
+	}{
+		{"extra rules in either direction", "a spoiler", 1, 2, "a *******", false, false},
+		{"extra rules reverse direction", "a spoiler", 2, 1, "a *******", false, false},
+		{"extra rules keep global ones", "badword", 1, 2, "badword", true, false},
+		{"other conversations unaffected", "a spoiler", 1, 3, "a spoiler", false, false},
+		{"disabled", "badword", 4, 3, "badword", false, false},
+		{"dry run", "badword", 5, 6, "badword", false, false},
+		{"links replaced", "see https://example.com", 7, 8, "see https://example.com", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Check(tt.content, tt.sender, tt.receiver)
+			if got.Content != tt.want || got.Rejected != tt.rejected || got.Flagged != tt.flagged {
+				t.Errorf("Check(%q, %d, %d) = %+v, want content %q rejected %v flagged %v",
+					tt.content, tt.sender, tt.receiver, got, tt.want, tt.rejected, tt.flagged)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package linkpreview
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	fetchTimeout   = 5 * time.Second
+	maxBodyBytes   = 512 * 1024
+	maxRedirects   = 3
+	maxTitle       = 200
+	maxDescription = 500
+	userAgent      = "ScuffedSnapBot/1.0 (+link preview)"
+)
+
+// Preview is the OpenGraph / Twitter card metadata of a page
+type Preview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"image_url,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+}
+
+// urlPattern finds http(s) links in message text
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"'` + "`" + `]+`)
+
+// FindURL returns the first http(s) URL in content, or "" if there is none
+func FindURL(content string) string {
+	match := urlPattern.FindString(content)
+	// Sentence punctuation right after a link is not part of it
+	match = strings.TrimRight(match, ".,!?;:)]}")
+	if _, err := url.ParseRequestURI(match); err != nil {
+		return ""
+	}
+	return match
+}
+
+// client refuses to connect to anything but public addresses. The check
+// runs on the resolved IP at dial time, so redirects and DNS tricks cannot
+// reach internal services.
+var client = &http.Client{
+	Timeout: fetchTimeout,
+	Transport: &http.Transport{
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: fetchTimeout,
+			Control: checkDial,
+		}).DialContext,
+		TLSHandshakeTimeout:   fetchTimeout,
+		ResponseHeaderTimeout: fetchTimeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	},
+	CheckRedirect: checkRedirect,
+}
+
+// checkDial allows connections to public addresses on the web ports only
+func checkDial(network, address string, _ syscall.RawConn) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if port != "80" && port != "443" {
+		return fmt.Errorf("port %s not allowed", port)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("address %s not allowed", host)
+	}
+	return nil
+}
+
+// checkRedirect limits how many redirects are followed and to where
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("too many redirects")
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return fmt.Errorf("redirect to %s not allowed", req.URL.Scheme)
+	}
+	return nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, which net.IP does not
+// count as private
+var _, sharedAddressSpace, _ = net.ParseCIDR("100.64.0.0/10")
+
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() ||
+		sharedAddressSpace.Contains(ip))
+}
+
+// Fetch downloads a page and extracts its preview metadata. Only HTML
+// pages with at least a title produce a preview.
+func Fetch(rawURL string) (*Preview, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid url %q", rawURL)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if !strings.Contains(resp.Header.Get("Content-Type"), "text/html") {
+		return nil, fmt.Errorf("not html: %s", resp.Header.Get("Content-Type"))
+	}
+
+	preview := parse(io.LimitReader(resp.Body, maxBodyBytes), resp.Request.URL)
+	if preview.Title == "" {
+		return nil, fmt.Errorf("no title")
+	}
+	preview.URL = rawURL
+	return preview, nil
+}
+
+// parse reads the metadata in a page's <head>, preferring OpenGraph tags
+// over Twitter card tags over plain HTML
+func parse(body io.Reader, base *url.URL) *Preview {
+	meta := make(map[string]string)
+	var title string
+
+	z := html.NewTokenizer(body)
+	inTitle := false
+loop:
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			break loop
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "body":
+				break loop
+			case "title":
+				inTitle = true
+			case "meta":
+				var key, content string
+				for hasAttr {
+					var k, v []byte
+					k, v, hasAttr = z.TagAttr()
+					switch string(k) {
+					case "property", "name":
+						key = strings.ToLower(string(v))
+					case "content":
+						content = strings.TrimSpace(string(v))
+					}
+				}
+				if _, seen := meta[key]; key != "" && content != "" && !seen {
+					meta[key] = content
+				}
+			}
+		case html.TextToken:
+			if inTitle && title == "" {
+				title = strings.TrimSpace(string(z.Text()))
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				break loop
+			}
+		}
+	}
+
+	first := func(keys ...string) string {
+		for _, k := range keys {
+			if v := meta[k]; v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	p := &Preview{
+		Title:       truncate(first("og:title", "twitter:title"), maxTitle),
+		Description: truncate(first("og:description", "twitter:description", "description"), maxDescription),
+		SiteName:    truncate(first("og:site_name"), maxTitle),
+	}
+	if p.Title == "" {
+		p.Title = truncate(title, maxTitle)
+	}
+
+	if image := first("og:image", "og:image:url", "twitter:image", "twitter:image:src"); image != "" {
+		if ref, err := base.Parse(image); err == nil && (ref.Scheme == "http" || ref.Scheme == "https") {
+			p.ImageURL = ref.String()
+		}
+	}
+	return p
+}
+
+func truncate(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max]) + "..."
+}
@@ -0,0 +1,186 @@
+package linkpreview
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestFindURL(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"no links here", ""},
+		{"see https://example.com/page", "https://example.com/page"},
+		{"first http://a.example then https://b.example", "http://a.example"},
+		{"trailing punctuation https://example.com/x.", "https://example.com/x"},
+		{"(https://example.com/y)", "https://example.com/y"},
+		{"not a link ftp://example.com", ""},
+	}
+
+	for _, tt := range tests {
+		if got := FindURL(tt.content); got != tt.want {
+			t.Errorf("FindURL(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"224.0.0.1", false},
+		{"fc00::1", false},
+		{"fe80::1", false},
+		{"::ffff:127.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		if got := isPublicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("isPublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestCheckDial(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"93.184.216.34:443", true},
+		{"93.184.216.34:80", true},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", true},
+		{"93.184.216.34:22", false},
+		{"93.184.216.34:8080", false},
+		{"127.0.0.1:80", false},
+		{"169.254.169.254:80", false},
+		{"[::1]:443", false},
+		{"not-an-address", false},
+	}
+
+	for _, tt := range tests {
+		err := checkDial("tcp", tt.address, nil)
+		if (err == nil) != tt.allowed {
+			t.Errorf("checkDial(%s) error = %v, want allowed %v", tt.address, err, tt.allowed)
+		}
+	}
+}
+
+func TestCheckRedirect(t *testing.T) {
+	req := func(rawURL string) *http.Request {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &http.Request{URL: u}
+	}
+	via := func(n int) []*http.Request {
+		return make([]*http.Request, n)
+	}
+
+	tests := []struct {
+		name    string
+		target  string
+		hops    int
+		allowed bool
+	}{
+		{"https redirect", "https://example.com", 1, true},
+		{"http redirect", "http://example.com", 2, true},
+		{"too many redirects", "https://example.com", maxRedirects, false},
+		{"file scheme", "file:///etc/passwd", 1, false},
+		{"gopher scheme", "gopher://example.com", 1, false},
+	}
+
+	for _, tt := range tests {
+		err := checkRedirect(req(tt.target), via(tt.hops))
+		if (err == nil) != tt.allowed {
+			t.Errorf("%s: error = %v, want allowed %v", tt.name, err, tt.allowed)
+		}
+	}
+}
+
+func TestFetchRefusesLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<title>internal</title>"))
+	}))
+	defer server.Close()
+
+	if _, err := Fetch(server.URL); err == nil {
+		t.Fatal("Fetch reached a loopback server")
+	}
+}
+
+func TestParse(t *testing.T) {
+	base, _ := url.Parse("https://example.com/articles/1")
+
+	tests := []struct {
+		name string
+		page string
+		want Preview
+	}{
+		{
+			name: "plain title",
+			page: `<html><head><title> Hello </title></head></html>`,
+			want: Preview{Title: "Hello"},
+		},
+		{
+			name: "OpenGraph wins over Twitter and HTML",
+			page: `<head><title>HTML</title>
+				<meta name="twitter:title" content="Twitter">
+				<meta property="og:title" content="OG">
+				<meta name="description" content="Plain description">
+				<meta property="og:site_name" content="Example"></head>`,
+			want: Preview{Title: "OG", Description: "Plain description", SiteName: "Example"},
+		},
+		{
+			name: "relative image resolved against the page",
+			page: `<head><meta property="og:title" content="T"><meta property="og:image" content="/img/a.png"></head>`,
+			want: Preview{Title: "T", ImageURL: "https://example.com/img/a.png"},
+		},
+		{
+			name: "non-http image dropped",
+			page: `<head><meta property="og:title" content="T"><meta property="og:image" content="javascript:alert(1)"></head>`,
+			want: Preview{Title: "T"},
+		},
+		{
+			name: "first duplicate tag wins",
+			page: `<head><meta property="og:title" content="First"><meta property="og:title" content="Second"></head>`,
+			want: Preview{Title: "First"},
+		},
+		{
+			name: "body is not read",
+			page: `<head></head><body><title>Late</title><meta property="og:title" content="Late"></body>`,
+			want: Preview{},
+		},
+		{
+			name: "long title truncated",
+			page: `<title>` + strings.Repeat("a", maxTitle+10) + `</title>`,
+			want: Preview{Title: strings.Repeat("a", maxTitle) + "..."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parse(strings.NewReader(tt.page), base)
+			if *got != tt.want {
+				t.Errorf("parse() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
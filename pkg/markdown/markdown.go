@@ -0,0 +1,243 @@
+// Package markdown renders the small Markdown subset allowed in messages:
+// bold, italics, inline code, fenced code blocks, links and quotes. Anything
+// else, raw HTML included, comes out as escaped text, so the result is safe
+// to insert into a page as is.
+package markdown
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Render converts message Markdown to sanitized HTML
+func Render(src string) string {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	lines := strings.Split(src, "\n")
+
+	var b strings.Builder
+	var paragraph []string
+
+	flush := func() {
+		if len(paragraph) > 0 {
+			b.WriteString("<p>")
+			b.WriteString(renderLines(paragraph))
+			b.WriteString("</p>")
+			paragraph = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			flush()
+			lang := strings.TrimSpace(strings.TrimPrefix(trimmed, "```"))
+			var code []string
+			for i++; i < len(lines) && strings.TrimSpace(lines[i]) != "```"; i++ {
+				code = append(code, lines[i])
+			}
+			b.WriteString("<pre><code")
+			if languagePattern.MatchString(lang) {
+				b.WriteString(` class="language-` + lang + `"`)
+			}
+			b.WriteString(">")
+			b.WriteString(html.EscapeString(strings.Join(code, "\n")))
+			b.WriteString("</code></pre>")
+
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			var quote []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				// Nested quotes are flattened into one level
+				q := strings.TrimLeft(strings.TrimSpace(lines[i]), ">")
+				quote = append(quote, strings.TrimPrefix(q, " "))
+			}
+			i--
+			b.WriteString("<blockquote>")
+			b.WriteString(renderLines(quote))
+			b.WriteString("</blockquote>")
+
+		case trimmed == "":
+			flush()
+
+		default:
+			// Headings are not supported; keep the text without the markers
+			if m := headingPattern.FindStringSubmatch(trimmed); m != nil {
+				line = m[1]
+			}
+			paragraph = append(paragraph, line)
+		}
+	}
+	flush()
+
+	return b.String()
+}
+
+var (
+	languagePattern = regexp.MustCompile(`^[a-zA-Z0-9_+-]{1,20}$`)
+	headingPattern  = regexp.MustCompile(`^#{1,6}\s+(.*)$`)
+	autolinkPattern = regexp.MustCompile(`^https?://[^\s<>"'` + "`" + `]+`)
+)
+
+// renderLines renders inline markup for each line and joins them with <br>
+func renderLines(lines []string) string {
+	rendered := make([]string, len(lines))
+	for i, line := range lines {
+		rendered[i] = renderInline(line, true)
+	}
+	return strings.Join(rendered, "<br>")
+}
+
+// renderInline renders spans within one line. Links are not allowed inside
+// link text, so allowLinks is false when rendering it.
+func renderInline(s string, allowLinks bool) string {
+	var b strings.Builder
+	var text strings.Builder
+
+	flush := func() {
+		b.WriteString(html.EscapeString(text.String()))
+		text.Reset()
+	}
+	emit := func(markup string) {
+		flush()
+		b.WriteString(markup)
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte("\\`*_[]()>#!", s[i+1]) >= 0:
+			text.WriteByte(s[i+1])
+			i += 2
+			continue
+
+		case c == '`':
+			if end := strings.IndexByte(s[i+1:], '`'); end > 0 {
+				emit("<code>" + html.EscapeString(s[i+1:i+1+end]) + "</code>")
+				i += end + 2
+				continue
+			}
+
+		case strings.HasPrefix(s[i:], "**"):
+			if end := strings.Index(s[i+2:], "**"); end > 0 && isFlanked(s[i+2:i+2+end]) {
+				emit("<strong>" + renderInline(s[i+2:i+2+end], allowLinks) + "</strong>")
+				i += end + 4
+				continue
+			}
+
+		case c == '*' || c == '_':
+			// Underscores inside words (snake_case) are not emphasis
+			if c == '_' && i > 0 && isWordByte(s[i-1]) {
+				break
+			}
+			if end := strings.IndexByte(s[i+1:], c); end > 0 && isFlanked(s[i+1:i+1+end]) {
+				after := i + 2 + end
+				if c != '_' || after >= len(s) || !isWordByte(s[after]) {
+					emit("<em>" + renderInline(s[i+1:i+1+end], allowLinks) + "</em>")
+					i = after
+					continue
+				}
+			}
+
+		case c == '!' && i+1 < len(s) && s[i+1] == '[':
+			// Images are not allowed; keep the alt text
+			if label, _, n := parseLink(s[i+1:]); n > 0 {
+				emit(renderInline(label, false))
+				i += 1 + n
+				continue
+			}
+
+		case c == '[' && allowLinks:
+			if label, target, n := parseLink(s[i:]); n > 0 {
+				if href, ok := safeURL(target); ok {
+					emit(`<a href="` + html.EscapeString(href) + `" rel="noopener noreferrer nofollow" target="_blank">` +
+						renderInline(label, false) + "</a>")
+				} else {
+					emit(renderInline(label, false))
+				}
+				i += n
+				continue
+			}
+
+		case (c == 'h' || c == 'H') && allowLinks && (i == 0 || !isWordByte(s[i-1])):
+			if m := autolinkPattern.FindString(s[i:]); m != "" {
+				m = strings.TrimRight(m, ".,!?;:)]}")
+				if href, ok := safeURL(m); ok {
+					emit(`<a href="` + html.EscapeString(href) + `" rel="noopener noreferrer nofollow" target="_blank">` +
+						html.EscapeString(m) + "</a>")
+					i += len(m)
+					continue
+				}
+			}
+		}
+
+		text.WriteByte(c)
+		i++
+	}
+	flush()
+
+	return b.String()
+}
+
+// parseLink parses "[label](target)" at the start of s and returns its
+// parts and length, or n == 0 if s does not start with a link
+func parseLink(s string) (label, target string, n int) {
+	if !strings.HasPrefix(s, "[") {
+		return "", "", 0
+	}
+	closeLabel := strings.Index(s, "](")
+	if closeLabel < 1 {
+		return "", "", 0
+	}
+	// Parentheses inside the target must balance, as in Wikipedia links
+	closeTarget, depth := -1, 0
+	for j, c := range s[closeLabel+2:] {
+		if c == '(' {
+			depth++
+		} else if c == ')' {
+			if depth == 0 {
+				closeTarget = j
+				break
+			}
+			depth--
+		}
+	}
+	if closeTarget < 1 {
+		return "", "", 0
+	}
+	label = s[1:closeLabel]
+	target = strings.TrimSpace(s[closeLabel+2 : closeLabel+2+closeTarget])
+	return label, target, closeLabel + 3 + closeTarget
+}
+
+// safeURL allows only absolute http(s) and mailto links
+func safeURL(raw string) (string, bool) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		if u.Host == "" {
+			return "", false
+		}
+	case "mailto":
+	default:
+		return "", false
+	}
+	return u.String(), true
+}
+
+// isFlanked reports whether emphasized text hugs its delimiters, so that
+// "2 * 3 * 4" stays plain
+func isFlanked(inner string) bool {
+	return inner[0] != ' ' && inner[len(inner)-1] != ' '
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
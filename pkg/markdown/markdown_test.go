@@ -0,0 +1,128 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"plain text", "hello", "<p>hello</p>"},
+		{"bold", "**bold**", "<p><strong>bold</strong></p>"},
+		{"italics", "*it* and _it_", "<p><em>it</em> and <em>it</em></p>"},
+		{"snake_case is not emphasis", "snake_case_name", "<p>snake_case_name</p>"},
+		{"spaced asterisks are not emphasis", "2 * 3 * 4", "<p>2 * 3 * 4</p>"},
+		{"inline code is escaped", "`<b>x</b>`", "<p><code>&lt;b&gt;x&lt;/b&gt;</code></p>"},
+		{"markup inside code is literal", "`**x**`", "<p><code>**x**</code></p>"},
+		{"backslash escape", `\*not em\*`, "<p>*not em*</p>"},
+		{"line breaks", "a\nb", "<p>a<br>b</p>"},
+		{"paragraphs", "a\n\nb", "<p>a</p><p>b</p>"},
+		{"CRLF", "a\r\nb", "<p>a<br>b</p>"},
+		{
+			"fenced code block",
+			"```go\nx := <-ch\n```",
+			`<pre><code class="language-go">x := &lt;-ch</code></pre>`,
+		},
+		{
+			"unsafe code language dropped",
+			"```\"><script>\nx\n```",
+			"<pre><code>x</code></pre>",
+		},
+		{"quote", "> a\n> b", "<blockquote>a<br>b</blockquote>"},
+		{"nested quote flattened", ">> deep", "<blockquote>deep</blockquote>"},
+		{
+			"link",
+			"[site](https://example.com/a?b=1&c=2)",
+			`<p><a href="https://example.com/a?b=1&amp;c=2" rel="noopener noreferrer nofollow" target="_blank">site</a></p>`,
+		},
+		{
+			"link with balanced parentheses",
+			"[wiki](https://en.wikipedia.org/wiki/Go_(language))",
+			`<p><a href="https://en.wikipedia.org/wiki/Go_(language)" rel="noopener noreferrer nofollow" target="_blank">wiki</a></p>`,
+		},
+		{
+			"autolink without trailing punctuation",
+			"see https://example.com.",
+			`<p>see <a href="https://example.com" rel="noopener noreferrer nofollow" target="_blank">https://example.com</a>.</p>`,
+		},
+		{
+			"no links inside link text",
+			"[https://a.example](https://b.example)",
+			`<p><a href="https://b.example" rel="noopener noreferrer nofollow" target="_blank">https://a.example</a></p>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(tt.src); got != tt.want {
+				t.Errorf("Render(%q)\n got  %s\n want %s", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRenderDisallowed checks that unsupported and dangerous constructs come
+// out as text
+func TestRenderDisallowed(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"raw HTML", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>"},
+		{"HTML attributes", `<img src=x onerror="alert(1)">`, "<p>&lt;img src=x onerror=&#34;alert(1)&#34;&gt;</p>"},
+		{"heading markers dropped", "# Title", "<p>Title</p>"},
+		{"image keeps alt text", "![alt](https://example.com/a.png)", "<p>alt</p>"},
+		{"javascript link", "[click](javascript:alert(1))", "<p>click</p>"},
+		{"data link", "[x](data:text/html,<b>)", "<p>x</p>"},
+		{"relative link", "[x](/admin)", "<p>x</p>"},
+		{"scheme-relative link", "[x](//evil.example)", "<p>x</p>"},
+		{"quote in link target", `[x](https://a.example/"onmouseover=")`, `<p><a href="https://a.example/%22onmouseover=%22" rel="noopener noreferrer nofollow" target="_blank">x</a></p>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Render(tt.src)
+			if got != tt.want {
+				t.Errorf("Render(%q)\n got  %s\n want %s", tt.src, got, tt.want)
+			}
+			for _, tag := range []string{"<script", "<img", "<h1", "javascript:"} {
+				if strings.Contains(got, tag) {
+					t.Errorf("Render(%q) contains %s", tt.src, tag)
+				}
+			}
+		})
+	}
+}
+
+func TestSafeURL(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+		ok   bool
+	}{
+		{"https://example.com", "https://example.com", true},
+		{"HTTP://example.com/x", "http://example.com/x", true},
+		{"mailto:someone@example.com", "mailto:someone@example.com", true},
+		{"https://", "", false},
+		{"javascript:alert(1)", "", false},
+		{"JaVaScRiPt:alert(1)", "", false},
+		{"vbscript:msgbox", "", false},
+		{"data:text/html;base64,PHNjcmlwdD4=", "", false},
+		{"file:///etc/passwd", "", false},
+		{"/relative/path", "", false},
+		{"//example.com", "", false},
+		{"%zz", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := safeURL(tt.raw)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("safeURL(%q) = %q, %v, want %q, %v", tt.raw, got, ok, tt.want, tt.ok)
+		}
+	}
+}
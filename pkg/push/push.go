@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	webpush "github.com/SherClockHolmes/webpush-go"
@@ -188,6 +190,12 @@ func handleNewMessage(record map[string]interface{}) {
 }
 
 func getSubscriptionsFromSupabase(userID string) ([]PushSubscriptionStruct, error) {
+	return fetchSubscriptions("user_id=eq." + userID + "&")
+}
+
+// fetchSubscriptions reads push subscriptions matching a PostgREST filter
+// ("" for all of them)
+func fetchSubscriptions(filter string) ([]PushSubscriptionStruct, error) {
 	supabaseURL := os.Getenv("SUPABASE_URL")
 	anonKey := os.Getenv("SUPABASE_ANON_KEY")
 	// Use Service Role key if available to bypass RLS
@@ -200,7 +208,7 @@ func getSubscriptionsFromSupabase(userID string) ([]PushSubscriptionStruct, erro
 	}
 
 	client := &http.Client{Timeout: 10 * time.Second}
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/rest/v1/push_subscriptions?user_id=eq.%s&select=endpoint,auth,p256dh", supabaseURL, userID), nil)
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/rest/v1/push_subscriptions?%sselect=endpoint,auth,p256dh", supabaseURL, filter), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -255,6 +263,116 @@ func sendPushNamespace(sub PushSubscriptionStruct, content, msgType string) {
 		}
 	}
 
+	ok := sendNotification(sub, Notification{
+		Title: "New Message",
+		Body:  content,
+		URL:   "/app", // Open app
+	})
+	if !ok {
+		deleteSubscriptionFromSupabase(sub.Endpoint)
+	}
+}
+
+// Notification is the payload the service worker displays
+type Notification struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	URL   string `json:"url"`
+	Badge *int   `json:"badge,omitempty"` // App badge count, if known; 0 clears it
+}
+
+// SubscriptionStore looks up and forgets push subscriptions. By default
+// they are read from Supabase, keyed by Supabase user ID; the local
+// database API plugs in its own store keyed by local user ID.
+type SubscriptionStore interface {
+	// Subscriptions returns a user's subscriptions, or all of them for ""
+	Subscriptions(userID string) ([]PushSubscriptionStruct, error)
+	Delete(endpoint string)
+}
+
+type supabaseStore struct{}
+
+func (supabaseStore) Subscriptions(userID string) ([]PushSubscriptionStruct, error) {
+	if userID == "" {
+		return fetchSubscriptions("")
+	}
+	return getSubscriptionsFromSupabase(userID)
+}
+
+func (supabaseStore) Delete(endpoint string) {
+	deleteSubscriptionFromSupabase(endpoint)
+}
+
+var store SubscriptionStore = supabaseStore{}
+
+// SetSubscriptionStore replaces where SendToUser and SendToAll find
+// subscriptions. The Supabase webhook keeps using Supabase.
+func SetSubscriptionStore(s SubscriptionStore) {
+	store = s
+}
+
+// SendToUser delivers a notification to every subscription of a user
+func SendToUser(userID string, n Notification) {
+	sendToStore(store, userID, n)
+}
+
+// SendToAll delivers a notification to every known subscription
+func SendToAll(n Notification) {
+	sendToStore(store, "", n)
+}
+
+func sendToStore(s SubscriptionStore, userID string, n Notification) {
+	subscriptions, err := s.Subscriptions(userID)
+	if err != nil {
+		log.Println("Failed to get subscriptions:", err)
+		return
+	}
+
+	for _, sub := range subscriptions {
+		go func(sub PushSubscriptionStruct) {
+			if !sendNotification(sub, n) {
+				s.Delete(sub.Endpoint)
+			}
+		}(sub)
+	}
+}
+
+// pushServiceHosts are the browser push services subscriptions may point
+// at. Subdomains match too. Anything else would let a client make the
+// server POST to a host of its choosing.
+var pushServiceHosts = []string{
+	"fcm.googleapis.com",        // Chrome and other Chromium browsers
+	"android.googleapis.com",    // Older Chrome subscriptions
+	"push.services.mozilla.com", // Firefox
+	"push.apple.com",            // Safari
+	"notify.windows.com",        // Edge on Windows (WNS)
+}
+
+// AllowedEndpoint reports whether endpoint is an https URL of a known push
+// service on the default port
+func AllowedEndpoint(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" || u.User != nil || (u.Port() != "" && u.Port() != "443") {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range pushServiceHosts {
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// sendNotification pushes n to one subscription. It returns false when the
+// push service says the subscription is gone and should be deleted, or when
+// it does not point at a known push service.
+func sendNotification(sub PushSubscriptionStruct, n Notification) bool {
+	if !AllowedEndpoint(sub.Endpoint) {
+		log.Printf("Refusing push to unknown endpoint host, deleting subscription")
+		return false
+	}
+
 	s := &webpush.Subscription{
 		Endpoint: sub.Endpoint,
 		Keys: webpush.Keys{
@@ -264,11 +382,7 @@ func sendPushNamespace(sub PushSubscriptionStruct, content, msgType string) {
 	}
 
 	// Send Notification
-	payload, _ := json.Marshal(map[string]string{
-		"title": "New Message",
-		"body":  content,
-		"url":   "/app", // Open app
-	})
+	payload, _ := json.Marshal(n)
 
 	resp, err := webpush.SendNotification(payload, s, &webpush.Options{
 		Subscriber:      "mailto:pazeb@example.com", // Should be real email
@@ -278,15 +392,16 @@ func sendPushNamespace(sub PushSubscriptionStruct, content, msgType string) {
 	})
 	if err != nil {
 		log.Println("Push error:", err)
-		return
+		return true
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == 410 || resp.StatusCode == 401 || resp.StatusCode == 403 {
 		// Delete subscription i it's gone or invalid
 		log.Printf("Subscription invalid (Status %d), deleting...", resp.StatusCode)
-		deleteSubscriptionFromSupabase(sub.Endpoint)
+		return false
 	}
+	return true
 }
 
 func deleteSubscriptionFromSupabase(endpoint string) {
@@ -0,0 +1,31 @@
+package push
+
+import "testing"
+
+func TestAllowedEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     bool
+	}{
+		{"https://fcm.googleapis.com/fcm/send/abc", true},
+		{"https://updates.push.services.mozilla.com/wpush/v2/abc", true},
+		{"https://web.push.apple.com/abc", true},
+		{"https://wns2-par02p.notify.windows.com/w/?token=abc", true},
+		{"https://FCM.googleapis.com:443/fcm/send/abc", true},
+		{"http://fcm.googleapis.com/fcm/send/abc", false},
+		{"https://fcm.googleapis.com:8443/fcm/send/abc", false},
+		{"https://user@fcm.googleapis.com/fcm/send/abc", false},
+		{"https://169.254.169.254/latest/meta-data", false},
+		{"https://localhost:8080/admin", false},
+		{"https://fcm.googleapis.com.evil.example/abc", false},
+		{"https://evilfcm.googleapis.com.example/abc", false},
+		{"https://notfcm.googleapis.com/abc", false},
+		{"not a url", false},
+	}
+
+	for _, tt := range tests {
+		if got := AllowedEndpoint(tt.endpoint); got != tt.want {
+			t.Errorf("AllowedEndpoint(%q) = %v, want %v", tt.endpoint, got, tt.want)
+		}
+	}
+}
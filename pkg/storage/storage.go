@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// publicObjectPath is the path prefix of Supabase public object URLs
+const publicObjectPath = "/storage/v1/object/public/"
+
+// IsStorageURL reports whether url points at an object in this project's
+// Supabase storage
+func IsStorageURL(url string) bool {
+	supabaseURL := strings.TrimRight(os.Getenv("SUPABASE_URL"), "/")
+	return supabaseURL != "" && strings.HasPrefix(url, supabaseURL+publicObjectPath)
+}
+
+// objectPath returns "<bucket>/<path>" of a Supabase public object URL
+func objectPath(url string) (string, error) {
+	if !IsStorageURL(url) {
+		return "", fmt.Errorf("not a storage URL: %s", url)
+	}
+	supabaseURL := strings.TrimRight(os.Getenv("SUPABASE_URL"), "/")
+	path := strings.TrimPrefix(url, supabaseURL+publicObjectPath)
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path = path[:i]
+	}
+	return path, nil
+}
+
+// serviceRequest sends an authenticated storage API request with the
+// service role key, which storage policies do not restrict
+func serviceRequest(method, endpoint string, body io.Reader) (*http.Response, error) {
+	serviceKey := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
+	if serviceKey == "" {
+		return nil, fmt.Errorf("SUPABASE_SERVICE_ROLE_KEY not set")
+	}
+
+	supabaseURL := strings.TrimRight(os.Getenv("SUPABASE_URL"), "/")
+	req, err := http.NewRequest(method, supabaseURL+"/storage/v1/"+endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("apikey", serviceKey)
+	req.Header.Set("Authorization", "Bearer "+serviceKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	return client.Do(req)
+}
+
+// DeleteObject removes the object behind a Supabase public URL. It needs
+// the service role key since storage policies only let owners delete.
+func DeleteObject(url string) error {
+	path, err := objectPath(url)
+	if err != nil {
+		return err
+	}
+
+	// ".../object/public/<bucket>/<path>" is deleted via ".../object/<bucket>/<path>"
+	resp, err := serviceRequest("DELETE", "object/"+path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("supabase storage error: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SignedURL returns a URL for the object behind a Supabase public URL that
+// stops working after expiresIn. It works for private buckets too, so media
+// that should not be shareable can live in one.
+func SignedURL(url string, expiresIn time.Duration) (string, error) {
+	path, err := objectPath(url)
+	if err != nil {
+		return "", err
+	}
+
+	body, err := json.Marshal(map[string]int{"expiresIn": int(expiresIn / time.Second)})
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := serviceRequest("POST", "object/sign/"+path, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("supabase storage error: %d", resp.StatusCode)
+	}
+
+	var signed struct {
+		SignedURL string `json:"signedURL"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&signed); err != nil {
+		return "", err
+	}
+	if signed.SignedURL == "" {
+		return "", fmt.Errorf("supabase storage returned no signed URL")
+	}
+
+	// The returned URL is relative to the storage API
+	supabaseURL := strings.TrimRight(os.Getenv("SUPABASE_URL"), "/")
+	return supabaseURL + "/storage/v1" + signed.SignedURL, nil
+}
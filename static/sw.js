@@ -18,6 +18,11 @@ self.addEventListener('push', function(event) {
             }
         };
 
+        // Mirror the server's unread total on the app icon
+        if (payload.badge !== undefined && self.navigator.setAppBadge) {
+            self.navigator.setAppBadge(payload.badge).catch(() => {});
+        }
+
         event.waitUntil(
             Promise.all([
                 // Show notification with sound